@@ -0,0 +1,347 @@
+package audio
+
+import (
+	"math"
+	"sync"
+)
+
+// Limiter defaults
+const (
+	DefaultLimiterCeiling   = -1.0  // dBFS
+	DefaultLimiterRelease   = 0.1   // seconds
+	DefaultLimiterLookahead = 0.005 // seconds
+)
+
+// Limiter is a look-ahead peak limiter for the stereo master bus.
+// The signal is delayed by the look-ahead time so gain reduction can ramp
+// in before a peak arrives, keeping the output under the ceiling without
+// the distortion of hard clipping.
+// All methods are safe to call while audio is playing.
+type Limiter struct {
+	mu           sync.Mutex
+	sampleRate   float64
+	enabled      bool
+	ceiling      float64 // linear
+	releaseCoeff float64
+
+	// Delay line for the signal and the required gain
+	delayL, delayR []float64
+	required       []float64
+	pos            int
+
+	// Sliding minimum of the required gain (monotonic queue of positions)
+	minQueue []int
+	minHead  int
+	minLen   int
+
+	released float64 // Held minimum gain with release applied
+	smoothed []float64
+	sum      float64 // Running sum of smoothed, for the moving average
+	gain     float64 // Gain applied to the current output sample
+}
+
+// NewLimiter creates an enabled limiter with the default settings
+func NewLimiter(sampleRate float64) *Limiter {
+	l := &Limiter{
+		sampleRate: sampleRate,
+		enabled:    true,
+	}
+	l.SetCeiling(DefaultLimiterCeiling)
+	l.SetRelease(DefaultLimiterRelease)
+	l.SetLookahead(DefaultLimiterLookahead)
+	return l
+}
+
+// SetEnabled turns the limiter on or off
+func (l *Limiter) SetEnabled(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = enabled
+}
+
+// IsEnabled returns true if the limiter is processing audio
+func (l *Limiter) IsEnabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enabled
+}
+
+// SetCeiling sets the maximum output level in dBFS
+func (l *Limiter) SetCeiling(db float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ceiling = dbToGain(db)
+}
+
+// SetRelease sets how long gain takes to recover after a peak, in seconds
+func (l *Limiter) SetRelease(seconds float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseCoeff = timeCoeff(seconds, l.sampleRate)
+}
+
+// SetLookahead sets the look-ahead time in seconds, which is also the
+// latency the limiter adds. Changing it clears the limiter state.
+func (l *Limiter) SetLookahead(seconds float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := max(1, int(seconds*l.sampleRate))
+	l.delayL = make([]float64, n)
+	l.delayR = make([]float64, n)
+	l.required = make([]float64, n)
+	l.smoothed = make([]float64, n)
+	l.minQueue = make([]int, n)
+	l.reset()
+}
+
+// GetLookahead returns the look-ahead time (and latency) in seconds
+func (l *Limiter) GetLookahead() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return float64(len(l.delayL)) / l.sampleRate
+}
+
+// GetGainReduction returns the current gain reduction in dB (0 when idle)
+func (l *Limiter) GetGainReduction() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return -gainToDB(l.gain)
+}
+
+// Reset clears the delay line and gain state
+func (l *Limiter) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reset()
+}
+
+func (l *Limiter) reset() {
+	n := len(l.delayL)
+	for i := 0; i < n; i++ {
+		l.delayL[i], l.delayR[i] = 0.0, 0.0
+		l.required[i], l.smoothed[i] = 1.0, 1.0
+	}
+	l.pos = 0
+	l.minHead, l.minLen = 0, 0
+	l.released = 1.0
+	l.sum = float64(n)
+	l.gain = 1.0
+}
+
+// Process limits one stereo sample, returning the sample from one
+// look-ahead period ago
+func (l *Limiter) Process(left, right float64) (float64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.enabled {
+		l.gain = 1.0
+		return left, right
+	}
+
+	n := len(l.delayL)
+	pos := l.pos
+
+	// Gain this sample needs to stay under the ceiling
+	peak := math.Max(math.Abs(left), math.Abs(right))
+	required := 1.0
+	if peak > l.ceiling {
+		required = l.ceiling / peak
+	}
+
+	// Sliding minimum over the look-ahead window: drop the sample leaving
+	// the window, then any queued samples needing less reduction than this one
+	if l.minLen > 0 && l.minQueue[l.minHead] == pos {
+		l.minHead = (l.minHead + 1) % n
+		l.minLen--
+	}
+	l.required[pos] = required
+	for l.minLen > 0 && l.required[l.minQueue[(l.minHead+l.minLen-1)%n]] >= required {
+		l.minLen--
+	}
+	l.minQueue[(l.minHead+l.minLen)%n] = pos
+	l.minLen++
+	held := l.required[l.minQueue[l.minHead]]
+
+	// Attack instantly to the held minimum, release smoothly
+	if held < l.released {
+		l.released = held
+	} else {
+		l.released += (held - l.released) * l.releaseCoeff
+	}
+
+	// Moving average over the window ramps gain down ahead of the peak
+	l.sum += l.released - l.smoothed[pos]
+	l.smoothed[pos] = l.released
+	l.gain = math.Min(1.0, l.sum/float64(n))
+
+	// Output the oldest sample still in the window, so every gain that was
+	// averaged in was held at or below what that sample needs
+	l.delayL[pos], l.delayR[pos] = left, right
+	l.pos = (pos + 1) % n
+	outL, outR := l.delayL[l.pos], l.delayR[l.pos]
+
+	if l.pos == 0 {
+		// Resum now and then so rounding errors can't accumulate
+		l.sum = 0.0
+		for _, g := range l.smoothed {
+			l.sum += g
+		}
+	}
+
+	return outL * l.gain, outR * l.gain
+}
+
+// Compressor defaults
+const (
+	DefaultCompressorThreshold = -18.0 // dBFS
+	DefaultCompressorRatio     = 3.0
+	DefaultCompressorAttack    = 0.01 // seconds
+	DefaultCompressorRelease   = 0.15 // seconds
+	DefaultCompressorWindow    = 0.02 // seconds of RMS averaging
+)
+
+// Compressor is an RMS compressor for the stereo master bus.
+// It is disabled by default.
+// All methods are safe to call while audio is playing.
+type Compressor struct {
+	mu           sync.Mutex
+	sampleRate   float64
+	enabled      bool
+	threshold    float64 // dBFS
+	ratio        float64
+	makeup       float64 // linear
+	attackCoeff  float64
+	releaseCoeff float64
+	windowCoeff  float64
+
+	meanSquare float64
+	reduction  float64 // Current gain reduction in dB
+}
+
+// NewCompressor creates a disabled compressor with the default settings
+func NewCompressor(sampleRate float64) *Compressor {
+	return &Compressor{
+		sampleRate:   sampleRate,
+		threshold:    DefaultCompressorThreshold,
+		ratio:        DefaultCompressorRatio,
+		makeup:       1.0,
+		attackCoeff:  timeCoeff(DefaultCompressorAttack, sampleRate),
+		releaseCoeff: timeCoeff(DefaultCompressorRelease, sampleRate),
+		windowCoeff:  timeCoeff(DefaultCompressorWindow, sampleRate),
+	}
+}
+
+// SetEnabled turns the compressor on or off
+func (c *Compressor) SetEnabled(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = enabled
+}
+
+// IsEnabled returns true if the compressor is processing audio
+func (c *Compressor) IsEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled
+}
+
+// SetThreshold sets the RMS level in dBFS above which gain is reduced
+func (c *Compressor) SetThreshold(db float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = db
+}
+
+// SetRatio sets the compression ratio (e.g. 4 for 4:1)
+func (c *Compressor) SetRatio(ratio float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ratio = math.Max(1.0, ratio)
+}
+
+// SetAttack sets how fast gain is reduced, in seconds
+func (c *Compressor) SetAttack(seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attackCoeff = timeCoeff(seconds, c.sampleRate)
+}
+
+// SetRelease sets how fast gain recovers, in seconds
+func (c *Compressor) SetRelease(seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseCoeff = timeCoeff(seconds, c.sampleRate)
+}
+
+// SetMakeupGain sets the gain in dB applied after compression
+func (c *Compressor) SetMakeupGain(db float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.makeup = dbToGain(db)
+}
+
+// GetGainReduction returns the current gain reduction in dB (0 when idle)
+func (c *Compressor) GetGainReduction() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return 0.0
+	}
+	return c.reduction
+}
+
+// Reset clears the level detector
+func (c *Compressor) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.meanSquare = 0.0
+	c.reduction = 0.0
+}
+
+// Process compresses one stereo sample
+func (c *Compressor) Process(left, right float64) (float64, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.enabled {
+		return left, right
+	}
+
+	// RMS level detection
+	square := (left*left + right*right) / 2.0
+	c.meanSquare += (square - c.meanSquare) * c.windowCoeff
+	level := 10.0 * math.Log10(c.meanSquare+1e-12)
+
+	// Gain computer (hard knee)
+	target := 0.0
+	if level > c.threshold {
+		target = (level - c.threshold) * (1.0 - 1.0/c.ratio)
+	}
+
+	// Smooth gain changes
+	if target > c.reduction {
+		c.reduction += (target - c.reduction) * c.attackCoeff
+	} else {
+		c.reduction += (target - c.reduction) * c.releaseCoeff
+	}
+
+	gain := dbToGain(-c.reduction) * c.makeup
+	return left * gain, right * gain
+}
+
+// timeCoeff returns the one-pole smoothing coefficient for a time constant
+func timeCoeff(seconds, sampleRate float64) float64 {
+	if seconds <= 0 {
+		return 1.0
+	}
+	return 1.0 - math.Exp(-1.0/(seconds*sampleRate))
+}
+
+func dbToGain(db float64) float64 {
+	return math.Pow(10.0, db/20.0)
+}
+
+func gainToDB(gain float64) float64 {
+	return 20.0 * math.Log10(math.Max(gain, 1e-12))
+}
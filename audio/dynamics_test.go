@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLimiterCeiling(t *testing.T) {
+	const sampleRate = 44100.0
+	rng := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name    string
+		ceiling float64 // dBFS
+		signal  func(i int) (float64, float64)
+	}{
+		{"loud sine", -1.0, func(i int) (float64, float64) {
+			s := 4.0 * math.Sin(2.0*math.Pi*440.0*float64(i)/sampleRate)
+			return s, s
+		}},
+		{"impulses", -1.0, func(i int) (float64, float64) {
+			if i%1000 == 0 {
+				return 10.0, -10.0
+			}
+			return 0.1, 0.1
+		}},
+		{"square bursts", -6.0, func(i int) (float64, float64) {
+			if (i/5000)%2 == 0 {
+				return 0.2, 0.2
+			}
+			if (i/50)%2 == 0 {
+				return 3.0, -1.0
+			}
+			return -3.0, 1.0
+		}},
+		{"one-sided peaks", -3.0, func(i int) (float64, float64) {
+			return 0.0, 5.0 * math.Sin(2.0*math.Pi*60.0*float64(i)/sampleRate)
+		}},
+		{"noise", 0.0, func(i int) (float64, float64) {
+			return rng.NormFloat64() * 2.0, rng.NormFloat64() * 2.0
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(sampleRate)
+			limiter.SetCeiling(tt.ceiling)
+			ceiling := dbToGain(tt.ceiling)
+
+			for i := range int(sampleRate) {
+				left, right := limiter.Process(tt.signal(i))
+				if peak := math.Max(math.Abs(left), math.Abs(right)); peak > ceiling+1e-9 {
+					t.Fatalf("sample %d: peak %.6f over the %.6f ceiling", i, peak, ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterPassesQuietSignal(t *testing.T) {
+	const sampleRate = 44100.0
+	limiter := NewLimiter(sampleRate)
+	// The window holds the look-ahead worth of samples, the oldest being output
+	delay := int(math.Round(limiter.GetLookahead()*sampleRate)) - 1
+
+	input := func(i int) float64 {
+		return 0.5 * math.Sin(2.0*math.Pi*440.0*float64(i)/sampleRate)
+	}
+	for i := range 4096 {
+		left, right := limiter.Process(input(i), -input(i))
+		want := 0.0
+		if i >= delay {
+			want = input(i - delay)
+		}
+		if math.Abs(left-want) > 1e-9 || math.Abs(right+want) > 1e-9 {
+			t.Fatalf("sample %d = (%f, %f), want (%f, %f)", i, left, right, want, -want)
+		}
+	}
+	if got := limiter.GetGainReduction(); got != 0.0 {
+		t.Errorf("gain reduction = %f dB, want 0", got)
+	}
+}
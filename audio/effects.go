@@ -0,0 +1,331 @@
+package audio
+
+import (
+	"iter"
+	"math"
+
+	"github.com/cjbrigato/go-vtm/synth"
+	"github.com/cjbrigato/go-vtm/tracker"
+)
+
+// channelState holds the effect column state of a single channel
+type channelState struct {
+	notes   []int     // Base note per pattern voice (-1 if not triggered)
+	slots   []int     // Allocator voice of each pattern voice (-1 if none)
+	volumes []float64 // Volume per pattern voice, reset to the note velocity on trigger
+	pan     float64   // Stereo position (-1.0 left to 1.0 right)
+
+	pulseWidth float64 // Pulse width set by 9xx (0 = the instrument's)
+	cutoff     float64 // Filter cutoff in Hz set by Cxx/Dxy (0 = the instrument's)
+
+	effect byte // Effect command for the current row (0 if none)
+	param  int  // Effect parameter for the current row
+
+	slide        float64 // Accumulated pitch offset from slides (semitones)
+	portaTarget  float64 // Slide offset at which tone portamento stops
+	portaSpeed   int     // Remembered 3xx speed
+	vibratoSpeed int     // Remembered 4xy speed
+	vibratoDepth int     // Remembered 4xy depth
+	vibratoPhase float64 // Vibrato position (0.0 to 1.0)
+
+	// Instrument breakpoint envelopes of the current note (nil if none)
+	volumeEnv *synth.BreakpointPlayhead
+	pitchEnv  *synth.BreakpointPlayhead
+	panEnv    *synth.BreakpointPlayhead
+	envVolume float64 // Volume envelope value for this tick
+	envPitch  float64 // Pitch envelope value for this tick (semitones)
+	envPan    float64 // Pan envelope value for this tick, added to pan
+}
+
+func newChannelState(voices int) channelState {
+	notes := make([]int, voices)
+	slots := make([]int, voices)
+	volumes := make([]float64, voices)
+	for i := range notes {
+		notes[i] = -1
+		slots[i] = -1
+		volumes[i] = 1.0
+	}
+	return channelState{notes: notes, slots: slots, volumes: volumes, envVolume: 1.0}
+}
+
+// setEffect latches the effect column of a new row
+func (cs *channelState) setEffect(effect string) {
+	cs.effect, cs.param = 0, 0
+
+	command, param, ok := tracker.ParseEffect(effect)
+	if !ok || (command == tracker.EffectArpeggio && param == 0) {
+		return
+	}
+	cs.effect, cs.param = command, param
+
+	// Zero parameters reuse the previous value, like ProTracker
+	switch command {
+	case tracker.EffectTonePorta:
+		if param != 0 {
+			cs.portaSpeed = param
+		}
+	case tracker.EffectVibrato:
+		if param>>4 != 0 {
+			cs.vibratoSpeed = param >> 4
+		}
+		if param&0x0F != 0 {
+			cs.vibratoDepth = param & 0x0F
+		}
+	}
+}
+
+// slot returns the allocator voice playing a pattern voice, or -1
+func (cs *channelState) slot(voice int) int {
+	if voice < len(cs.slots) {
+		return cs.slots[voice]
+	}
+	return -1
+}
+
+// noteOn records a pattern-triggered note, its velocity and the allocator
+// voice playing it (-1 if it was dropped) so effects can retune it
+func (cs *channelState) noteOn(voice, slot, note int, velocity float64) {
+	for len(cs.notes) <= voice {
+		cs.notes = append(cs.notes, -1)
+		cs.slots = append(cs.slots, -1)
+		cs.volumes = append(cs.volumes, 1.0)
+	}
+	// A stolen allocator voice no longer plays its previous pattern voice
+	for i := range cs.slots {
+		if slot >= 0 && cs.slots[i] == slot {
+			cs.notes[i], cs.slots[i] = -1, -1
+		}
+	}
+	cs.notes[voice], cs.slots[voice] = note, slot
+	cs.volumes[voice] = velocity
+	if voice == 0 {
+		cs.slide = 0
+		cs.portaTarget = 0
+		cs.vibratoPhase = 0
+	}
+}
+
+// startEnvelopes restarts the breakpoint envelopes for a note played with
+// the given instrument
+func (cs *channelState) startEnvelopes(inst *tracker.Instrument) {
+	cs.volumeEnv, cs.pitchEnv, cs.panEnv = nil, nil, nil
+	cs.envVolume, cs.envPitch, cs.envPan = 1.0, 0.0, 0.0
+	if inst == nil {
+		return
+	}
+	if inst.VolumeEnvelope != nil {
+		cs.volumeEnv = inst.VolumeEnvelope.Playhead()
+	}
+	if inst.PitchEnvelope != nil {
+		cs.pitchEnv = inst.PitchEnvelope.Playhead()
+	}
+	if inst.PanEnvelope != nil {
+		cs.panEnv = inst.PanEnvelope.Playhead()
+	}
+}
+
+// releaseEnvelopes lets the breakpoint envelopes move past their sustain point
+func (cs *channelState) releaseEnvelopes() {
+	for _, env := range []*synth.BreakpointPlayhead{cs.volumeEnv, cs.pitchEnv, cs.panEnv} {
+		if env != nil {
+			env.Release()
+		}
+	}
+}
+
+// tickEnvelopes reads the breakpoint envelopes for this tick and moves them on
+func (cs *channelState) tickEnvelopes() {
+	if cs.volumeEnv != nil {
+		cs.envVolume = cs.volumeEnv.Value()
+		cs.volumeEnv.Advance()
+	}
+	if cs.pitchEnv != nil {
+		cs.envPitch = cs.pitchEnv.Value()
+		cs.pitchEnv.Advance()
+	}
+	if cs.panEnv != nil {
+		cs.envPan = cs.panEnv.Value()
+		cs.panEnv.Advance()
+	}
+}
+
+// processTick runs the tick-level effect processing for all channels.
+// Tick 0 is the row tick, where the notes have just been triggered.
+func (p *Player) processTick(tick int) {
+	for ch := range p.channels {
+		cs := &p.channels[ch]
+		x, y := cs.param>>4, cs.param&0x0F
+
+		var offset float64
+		switch cs.effect {
+		case tracker.EffectArpeggio:
+			switch tick % 3 {
+			case 1:
+				offset = float64(x)
+			case 2:
+				offset = float64(y)
+			}
+
+		case tracker.EffectPortaUp:
+			if tick > 0 {
+				cs.slide += float64(cs.param) / 16.0
+			}
+
+		case tracker.EffectPortaDown:
+			if tick > 0 {
+				cs.slide -= float64(cs.param) / 16.0
+			}
+
+		case tracker.EffectTonePorta:
+			if tick > 0 {
+				step := float64(cs.portaSpeed) / 16.0
+				if cs.slide < cs.portaTarget {
+					cs.slide = math.Min(cs.slide+step, cs.portaTarget)
+				} else {
+					cs.slide = math.Max(cs.slide-step, cs.portaTarget)
+				}
+			}
+
+		case tracker.EffectVibrato:
+			offset = math.Sin(2.0*math.Pi*cs.vibratoPhase) * float64(cs.vibratoDepth) / 8.0
+			cs.vibratoPhase += float64(cs.vibratoSpeed) / 64.0
+			cs.vibratoPhase -= math.Floor(cs.vibratoPhase)
+
+		case tracker.EffectSetPan:
+			if tick == 0 {
+				// 80 is center, with 128 steps to the left and 127 to the right
+				if cs.param < 0x80 {
+					cs.pan = float64(cs.param-0x80) / 128.0
+				} else {
+					cs.pan = float64(cs.param-0x80) / 127.0
+				}
+			}
+
+		case tracker.EffectPulseWidth:
+			if tick == 0 {
+				cs.pulseWidth = float64(cs.param) / 256.0
+			}
+
+		case tracker.EffectCutoff:
+			if tick == 0 {
+				cs.cutoff = 0.0
+				if cs.param > 0 {
+					cs.cutoff = 20.0 * math.Pow(1000.0, float64(cs.param)/255.0)
+				}
+			}
+
+		case tracker.EffectCutoffSlide:
+			if tick > 0 {
+				if cs.cutoff == 0 {
+					cs.cutoff = p.instrumentCutoff(ch)
+				}
+				if cs.cutoff > 0 {
+					cs.cutoff *= math.Exp2(float64(x-y) / 16.0)
+					cs.cutoff = math.Max(20.0, math.Min(20000.0, cs.cutoff))
+					p.applyCutoff(ch)
+				}
+			}
+
+		case tracker.EffectVolumeSlide:
+			if tick > 0 {
+				// Every pattern voice slides from its own velocity
+				for i := range cs.volumes {
+					cs.volumes[i] += float64(x-y) / 64.0
+					cs.volumes[i] = math.Max(0.0, math.Min(1.0, cs.volumes[i]))
+				}
+				p.applyVolume(ch)
+			}
+		}
+
+		cs.tickEnvelopes()
+		if cs.volumeEnv != nil {
+			p.applyVolume(ch)
+		}
+
+		p.applyPitch(ch, offset)
+		if tick == 0 {
+			// Keep the 9xx width and Cxx cutoff on notes triggered after them
+			p.applyPulseWidth(ch)
+			p.applyCutoff(ch)
+		}
+	}
+}
+
+// applyPitch retunes every pattern-triggered voice of a channel to its base
+// note plus the channel slide, the pitch envelope and the given per-tick
+// offset (in semitones)
+func (p *Player) applyPitch(ch int, offset float64) {
+	if ch >= len(p.VoiceAllocators) {
+		return
+	}
+	cs := &p.channels[ch]
+	shift := math.Pow(2.0, (cs.slide+cs.envPitch+offset)/12.0)
+	for voice, i := range p.patternVoices(ch) {
+		voice.SetFrequency(synth.NoteToFrequency(cs.notes[i]) * shift)
+	}
+}
+
+// applyVolume pushes the volume of each pattern-triggered voice, scaled by
+// the volume envelope, to the voice playing it
+func (p *Player) applyVolume(ch int) {
+	if ch >= len(p.VoiceAllocators) {
+		return
+	}
+	cs := &p.channels[ch]
+	for voice, i := range p.patternVoices(ch) {
+		voice.SetVolume(cs.volumes[i] * cs.envVolume)
+	}
+}
+
+// applyPulseWidth pushes the channel pulse width to every pattern-triggered voice
+func (p *Player) applyPulseWidth(ch int) {
+	if ch >= len(p.VoiceAllocators) {
+		return
+	}
+	cs := &p.channels[ch]
+	for voice := range p.patternVoices(ch) {
+		voice.SetPulseWidth(cs.pulseWidth)
+	}
+}
+
+// applyCutoff pushes the channel filter cutoff to every pattern-triggered voice
+func (p *Player) applyCutoff(ch int) {
+	if ch >= len(p.VoiceAllocators) {
+		return
+	}
+	cs := &p.channels[ch]
+	for voice := range p.patternVoices(ch) {
+		voice.SetFilterCutoff(cs.cutoff)
+	}
+}
+
+// instrumentCutoff returns the filter cutoff of the channel's main voice,
+// or 0 if it has no filter
+func (p *Player) instrumentCutoff(ch int) float64 {
+	if ch >= len(p.VoiceAllocators) {
+		return 0.0
+	}
+	if voice := p.VoiceAllocators[ch].GetVoice(p.channels[ch].slot(0)); voice != nil {
+		return voice.GetFilterCutoff()
+	}
+	return 0.0
+}
+
+// patternVoices yields the allocator voices of a channel playing
+// pattern-triggered notes, with their pattern voice numbers
+func (p *Player) patternVoices(ch int) iter.Seq2[*synth.Voice, int] {
+	return func(yield func(*synth.Voice, int) bool) {
+		cs := &p.channels[ch]
+		for i, note := range cs.notes {
+			if note < 0 {
+				continue
+			}
+			if voice := p.VoiceAllocators[ch].GetVoice(cs.slots[i]); voice != nil {
+				if !yield(voice, i) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cjbrigato/go-vtm/synth"
+)
+
+// patternVoice returns the synth voice playing a pattern voice of a channel
+func patternVoice(t *testing.T, p *Player, ch, voice int) *synth.Voice {
+	t.Helper()
+	v := p.VoiceAllocators[ch].GetVoice(p.channels[ch].slot(voice))
+	if v == nil {
+		t.Fatalf("pattern voice %d of channel %d is not playing", voice, ch)
+	}
+	return v
+}
+
+// nextTick renders the samples of one effect tick
+func nextTick(p *Player) {
+	for range p.samplesPerTick {
+		p.NextStereo()
+	}
+}
+
+func TestVolumeKeepsChordVelocities(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want [][2]float64 // Volume of pattern voices 0 and 1 on each tick
+	}{
+		{
+			name: "volume slide down",
+			src: `TEMPO 120
+TICKS 4
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+PATTERN 1 1
+CH 0:
+V0: C-4:A08
+V1: E-4v16
+ENDPATTERN
+SEQUENCE 0
+`,
+			want: [][2]float64{{1.0, 0.25}, {0.875, 0.125}, {0.75, 0.0}, {0.625, 0.0}},
+		},
+		{
+			name: "volume slide up",
+			src: `TEMPO 120
+TICKS 4
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+PATTERN 1 1
+CH 0:
+V0: C-4v48:A80
+V1: E-4v16
+ENDPATTERN
+SEQUENCE 0
+`,
+			want: [][2]float64{{0.75, 0.25}, {0.875, 0.375}, {1.0, 0.5}, {1.0, 0.625}},
+		},
+		{
+			name: "volume envelope",
+			src: `TEMPO 120
+TICKS 4
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+ENV Lead VOL 0:1.0 4:0.5
+PATTERN 1 1
+CH 0:
+V0: C-4
+V1: E-4v16
+ENDPATTERN
+SEQUENCE 0
+`,
+			want: [][2]float64{{1.0, 0.25}, {0.875, 0.21875}, {0.75, 0.1875}, {0.625, 0.15625}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewPlayer(loadModule(t, tt.src), 8000)
+			player.NextStereo()
+			for tick, want := range tt.want {
+				for voice, w := range want {
+					if got := patternVoice(t, player, 0, voice).GetVolume(); math.Abs(got-w) > 1e-9 {
+						t.Errorf("tick %d: voice %d volume = %.4f, want %.4f", tick, voice, got, w)
+					}
+				}
+				nextTick(player)
+			}
+		})
+	}
+}
+
+func TestEffectTicks(t *testing.T) {
+	// Pitch in semitones from C-4 and volume of the channel on each tick
+	type tick struct{ pitch, volume float64 }
+
+	tests := []struct {
+		name  string
+		ticks string   // TICKS line, "" for the default of 6
+		notes []string // One note per row on channel 0
+		want  [][]tick // Ticks of each row
+	}{
+		{
+			name:  "arpeggio",
+			ticks: "TICKS 4",
+			notes: []string{"C-4:037", "...:047"},
+			want: [][]tick{
+				{{0, 1}, {3, 1}, {7, 1}, {0, 1}},
+				{{0, 1}, {4, 1}, {7, 1}, {0, 1}},
+			},
+		},
+		{
+			name:  "portamento up then down",
+			ticks: "TICKS 4",
+			notes: []string{"C-4:110", "...:208"},
+			want: [][]tick{
+				{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
+				{{3, 1}, {2.5, 1}, {2, 1}, {1.5, 1}},
+			},
+		},
+		{
+			name:  "tone portamento",
+			ticks: "TICKS 4",
+			notes: []string{"C-4", "E-4:308", "...:300", "C-4:340"},
+			want: [][]tick{
+				{{0, 1}, {0, 1}, {0, 1}, {0, 1}},
+				{{0, 1}, {0.5, 1}, {1, 1}, {1.5, 1}},
+				{{1.5, 1}, {2, 1}, {2.5, 1}, {3, 1}},
+				{{3, 1}, {0, 1}, {0, 1}, {0, 1}},
+			},
+		},
+		{
+			name:  "vibrato",
+			ticks: "TICKS 4",
+			notes: []string{"C-4:448", "...:400"},
+			want: [][]tick{
+				{{0, 1}, {math.Sin(math.Pi / 8), 1}, {math.Sin(math.Pi / 4), 1}, {math.Sin(3 * math.Pi / 8), 1}},
+				{{1, 1}, {math.Sin(5 * math.Pi / 8), 1}, {math.Sin(3 * math.Pi / 4), 1}, {math.Sin(7 * math.Pi / 8), 1}},
+			},
+		},
+		{
+			name:  "volume slide",
+			ticks: "TICKS 4",
+			notes: []string{"C-4v32:A40", "...:A0F", "...:A0F"},
+			want: [][]tick{
+				{{0, 0.5}, {0, 0.5625}, {0, 0.625}, {0, 0.6875}},
+				{{0, 0.6875}, {0, 0.453125}, {0, 0.21875}, {0, 0}},
+				{{0, 0}, {0, 0}, {0, 0}, {0, 0}},
+			},
+		},
+		{
+			name:  "effects end with their row",
+			ticks: "TICKS 4",
+			notes: []string{"C-4:037", "...", "E-4:A08", "..."},
+			want: [][]tick{
+				{{0, 1}, {3, 1}, {7, 1}, {0, 1}},
+				{{0, 1}, {0, 1}, {0, 1}, {0, 1}},
+				{{4, 1}, {4, 0.875}, {4, 0.75}, {4, 0.625}},
+				{{4, 0.625}, {4, 0.625}, {4, 0.625}, {4, 0.625}},
+			},
+		},
+		{
+			name:  "three ticks per row",
+			ticks: "TICKS 3",
+			notes: []string{"C-4:110", "...:110"},
+			want: [][]tick{
+				{{0, 1}, {1, 1}, {2, 1}},
+				{{2, 1}, {3, 1}, {4, 1}},
+			},
+		},
+		{
+			name:  "default six ticks per row",
+			notes: []string{"C-4:220", "...:220"},
+			want: [][]tick{
+				{{0, 1}, {-2, 1}, {-4, 1}, {-6, 1}, {-8, 1}, {-10, 1}},
+				{{-10, 1}, {-12, 1}, {-14, 1}, {-16, 1}, {-18, 1}, {-20, 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "TEMPO 120\n" + tt.ticks + "\nINSTRUMENT Lead SINE 0.001 0.1 0.8 0.01\n" +
+				fmt.Sprintf("PATTERN %d 1\nCH 0: %s\nENDPATTERN\nSEQUENCE 0\n", len(tt.notes), strings.Join(tt.notes, " "))
+			player := NewPlayer(loadModule(t, src), 8000)
+			base := synth.NoteToFrequency(synth.ParseNote("C-4"))
+
+			rendered := 0
+			for row, ticks := range tt.want {
+				if len(ticks) != player.ticksPerRow {
+					t.Fatalf("row %d lists %d ticks, player has %d", row, len(ticks), player.ticksPerRow)
+				}
+				for n, want := range ticks {
+					// Render up to and including the first sample of the tick
+					for ; rendered <= row*player.samplesPerRow+n*player.samplesPerTick; rendered++ {
+						player.NextStereo()
+					}
+					voice := patternVoice(t, player, 0, 0)
+					pitch := 12.0 * math.Log2(voice.GetFrequency()/base)
+					if math.Abs(pitch-want.pitch) > 1e-9 || math.Abs(voice.GetVolume()-want.volume) > 1e-9 {
+						t.Errorf("row %d tick %d: pitch %.4f volume %.4f, want %.4f and %.4f",
+							row, n, pitch, voice.GetVolume(), want.pitch, want.volume)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPulseWidthEffect(t *testing.T) {
+	module := loadModule(t, `TEMPO 120
+INSTRUMENT Lead PULSE 0.001 0.1 1.0 0.01 width=0.75
+PATTERN 5 1
+CH 0: C-4:940 ...:920 E-4 ...:900 ...
+ENDPATTERN
+SEQUENCE 0
+`)
+	// The width of each row, from the share of samples above zero
+	want := []float64{0.25, 0.125, 0.125, 0.75, 0.75}
+
+	player := NewPlayer(module, 8000)
+	for row, w := range want {
+		high := 0
+		for range player.samplesPerRow {
+			if left, _ := player.NextStereo(); left > 0 {
+				high++
+			}
+		}
+		if got := float64(high) / float64(player.samplesPerRow); math.Abs(got-w) > 0.03 {
+			t.Errorf("row %d: pulse width %.3f, want %.3f", row, got, w)
+		}
+	}
+}
+
+func TestCutoffEffects(t *testing.T) {
+	module := loadModule(t, `TEMPO 120
+TICKS 4
+INSTRUMENT Lead SAW 0.001 0.1 1.0 0.01 cutoff=1000
+PATTERN 5 1
+CH 0: C-4:CFF ...:C80 ...:D10 ...:D04 ...:C00
+ENDPATTERN
+SEQUENCE 0
+`)
+	mid := 20.0 * math.Pow(1000.0, 128.0/255.0)
+	// Cutoff of the voice on each tick
+	want := [][]float64{
+		{20000, 20000, 20000, 20000},
+		{mid, mid, mid, mid},
+		{mid, mid * math.Exp2(1.0/16), mid * math.Exp2(2.0/16), mid * math.Exp2(3.0/16)},
+		{mid * math.Exp2(3.0/16), mid * math.Exp2(-1.0/16), mid * math.Exp2(-5.0/16), mid * math.Exp2(-9.0/16)},
+		{1000, 1000, 1000, 1000},
+	}
+
+	player := NewPlayer(module, 8000)
+	rendered := 0
+	for row, ticks := range want {
+		for n, w := range ticks {
+			for ; rendered <= row*player.samplesPerRow+n*player.samplesPerTick; rendered++ {
+				player.NextStereo()
+			}
+			if got := patternVoice(t, player, 0, 0).GetFilterCutoff(); math.Abs(got-w) > 1e-6*w {
+				t.Errorf("row %d tick %d: cutoff %.2f, want %.2f", row, n, got, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMixerGains(t *testing.T) {
+	bus := math.Pow(10.0, -DefaultHeadroom/20.0)
+
+	tests := []struct {
+		name  string
+		setup func(m *Mixer)
+		want  []float64 // Gain of each channel relative to the bus
+	}{
+		{"defaults", func(m *Mixer) {}, []float64{1, 1, 1}},
+		{"channel gain", func(m *Mixer) { m.SetChannelGain(1, 0.5) }, []float64{1, 0.5, 1}},
+		{"mute", func(m *Mixer) { m.SetChannelMute(0, true) }, []float64{0, 1, 1}},
+		{"unmute", func(m *Mixer) {
+			m.SetChannelMute(0, true)
+			m.SetChannelMute(0, false)
+		}, []float64{1, 1, 1}},
+		{"solo", func(m *Mixer) { m.SetChannelSolo(2, true) }, []float64{0, 0, 1}},
+		{"two solos", func(m *Mixer) {
+			m.SetChannelSolo(0, true)
+			m.SetChannelSolo(2, true)
+		}, []float64{1, 0, 1}},
+		{"unsolo", func(m *Mixer) {
+			m.SetChannelSolo(0, true)
+			m.SetChannelSolo(0, true)
+			m.SetChannelSolo(0, false)
+		}, []float64{1, 1, 1}},
+		{"muted solo", func(m *Mixer) {
+			m.SetChannelSolo(1, true)
+			m.SetChannelMute(1, true)
+		}, []float64{0, 0, 0}},
+		{"solo keeps channel gain", func(m *Mixer) {
+			m.SetChannelGain(1, 2.0)
+			m.SetChannelSolo(1, true)
+		}, []float64{0, 2, 0}},
+		{"master gain", func(m *Mixer) {
+			m.SetChannelGain(0, 0.5)
+			m.SetMasterGain(0.5)
+		}, []float64{0.25, 0.5, 0.5}},
+		{"no headroom", func(m *Mixer) { m.SetHeadroom(0) }, []float64{1 / bus, 1 / bus, 1 / bus}},
+		{"out of range channels", func(m *Mixer) {
+			m.SetChannelGain(3, 0.0)
+			m.SetChannelMute(-1, true)
+			m.SetChannelSolo(5, true)
+		}, []float64{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMixer(3)
+			tt.setup(m)
+			gains := m.channelGains()
+			if len(gains) != len(tt.want) {
+				t.Fatalf("%d gains, want %d", len(gains), len(tt.want))
+			}
+			for ch, want := range tt.want {
+				if math.Abs(gains[ch]-want*bus) > 1e-12 {
+					t.Errorf("channel %d gain = %f, want %f", ch, gains[ch]/bus, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayerChannelMixing(t *testing.T) {
+	src := `TEMPO 240
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+INSTRUMENT Bass SAW 0.001 0.1 0.8 0.01
+PATTERN 2 2
+CH 0: C-4i01 ===
+CH 1: C-2i02 ===
+ENDPATTERN
+SEQUENCE 0
+`
+	// render plays the module with a mixer setup and returns the left channel
+	render := func(setup func(p *Player)) []float64 {
+		player := NewPlayerWithOptions(loadModule(t, src), 8000, PlayerOptions{Channels: 2})
+		setup(player)
+		var out []float64
+		for !player.IsDone() {
+			left, _ := player.NextStereo()
+			out = append(out, left)
+		}
+		return out
+	}
+
+	both := render(func(p *Player) {})
+	lead := render(func(p *Player) { p.SetChannelMute(1, true) })
+	bass := render(func(p *Player) { p.SetChannelSolo(1, true) })
+	half := render(func(p *Player) {
+		p.SetChannelGain(0, 0.5)
+		p.SetChannelGain(1, 0.5)
+	})
+	silent := render(func(p *Player) {
+		p.SetChannelMute(0, true)
+		p.SetChannelMute(1, true)
+	})
+
+	var leadPeak float64
+	for i := range both {
+		leadPeak = math.Max(leadPeak, math.Abs(lead[i]))
+		if math.Abs(lead[i]+bass[i]-both[i]) > 1e-9 {
+			t.Fatalf("sample %d: muted and soloed channels add up to %f, want %f", i, lead[i]+bass[i], both[i])
+		}
+		if math.Abs(half[i]-both[i]/2) > 1e-9 {
+			t.Fatalf("sample %d: half gain gives %f, want %f", i, half[i], both[i]/2)
+		}
+		if silent[i] != 0 {
+			t.Fatalf("sample %d: all channels muted gives %f", i, silent[i])
+		}
+	}
+	if leadPeak == 0 {
+		t.Error("channel 0 alone is silent")
+	}
+}
@@ -0,0 +1,70 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestPanLaw(t *testing.T) {
+	// One channel is rendered centered as the reference, where each side
+	// carries the channel at -3dB
+	render := func(pan, effect string) (left, right, mono []float64) {
+		src := fmt.Sprintf(`TEMPO 240
+INSTRUMENT Lead SAW 0.001 0.1 0.8 0.01
+PAN 0 %s
+PATTERN 1 1
+CH 0: C-4%s
+ENDPATTERN
+SEQUENCE 0
+`, pan, effect)
+		module := loadModule(t, src)
+		player := NewPlayerWithOptions(module, 8000, PlayerOptions{Channels: 1})
+		for !player.IsDone() {
+			l, r := player.NextStereo()
+			left, right = append(left, l), append(right, r)
+		}
+		player = NewPlayerWithOptions(module, 8000, PlayerOptions{Channels: 1})
+		for !player.IsDone() {
+			mono = append(mono, player.Next())
+		}
+		return left, right, mono
+	}
+	center, _, _ := render("0", "")
+
+	tests := []struct {
+		pan, effect string
+		left, right float64 // Gain of each side relative to the channel level
+		mono        float64 // Gain of the mono mix
+	}{
+		{"-1", "", 1, 0, math.Sqrt2 / 2},
+		{"0", "", math.Sqrt2 / 2, math.Sqrt2 / 2, 1},
+		{"1", "", 0, 1, math.Sqrt2 / 2},
+		{"-0.5", "", math.Cos(math.Pi / 8), math.Sin(math.Pi / 8), math.Cos(math.Pi / 8)},
+		{"0", ":800", 1, 0, math.Sqrt2 / 2},
+		{"0", ":880", math.Sqrt2 / 2, math.Sqrt2 / 2, 1},
+		{"0", ":8FF", 0, 1, math.Sqrt2 / 2},
+		{"1", ":840", math.Cos(math.Pi / 8), math.Sin(math.Pi / 8), math.Cos(math.Pi / 8)},
+	}
+
+	for _, tt := range tests {
+		t.Run("PAN "+tt.pan+tt.effect, func(t *testing.T) {
+			left, right, mono := render(tt.pan, tt.effect)
+			for i, c := range center {
+				level := c * math.Sqrt2
+				if math.Abs(left[i]-level*tt.left) > 1e-9 || math.Abs(right[i]-level*tt.right) > 1e-9 {
+					t.Fatalf("sample %d = %f, %f, want %f, %f", i, left[i], right[i], level*tt.left, level*tt.right)
+				}
+				// Constant power: the two sides always add up to the channel level
+				if power := left[i]*left[i] + right[i]*right[i]; math.Abs(power-level*level) > 1e-9 {
+					t.Fatalf("sample %d has power %f, want %f", i, power, level*level)
+				}
+				// Mono keeps centered channels at their level, and hard
+				// panned ones 3dB down
+				if math.Abs(mono[i]-level*tt.mono) > 1e-9 {
+					t.Fatalf("sample %d mono = %f, want %f", i, mono[i], level*tt.mono)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// SampleFormat is how samples are encoded in WAV files and PCM streams
+type SampleFormat int
+
+const (
+	SampleS16 SampleFormat = iota // 16-bit signed integer
+	SampleS24                     // 24-bit signed integer
+	SampleS32                     // 32-bit signed integer
+	SampleF32                     // 32-bit IEEE float
+)
+
+// BytesPerSample returns the size of one encoded sample
+func (f SampleFormat) BytesPerSample() int {
+	switch f {
+	case SampleS24:
+		return 3
+	case SampleS32, SampleF32:
+		return 4
+	default:
+		return 2
+	}
+}
+
+// IsFloat returns true for floating point formats
+func (f SampleFormat) IsFloat() bool {
+	return f == SampleF32
+}
+
+// ditherSeed makes dithered output reproducible
+const ditherSeed = 0xd1ce
+
+// sampleEncoder converts samples from -1.0 to 1.0 into little-endian bytes.
+// Integer formats are rounded with optional TPDF dither and first-order
+// noise shaping, and clipped to their range; floats are written as they are.
+type sampleEncoder struct {
+	format  SampleFormat
+	dither  bool
+	shaping bool
+	rng     *rand.Rand
+	errors  [2]float64 // Quantization error of the last sample of each channel
+}
+
+func newSampleEncoder(format SampleFormat, dither, shaping bool) *sampleEncoder {
+	return &sampleEncoder{
+		format:  format,
+		dither:  dither,
+		shaping: shaping,
+		rng:     rand.New(rand.NewPCG(ditherSeed, 0)),
+	}
+}
+
+// appendSample encodes one sample of channel ch (0 or 1) onto buf
+func (e *sampleEncoder) appendSample(buf []byte, x float64, ch int) []byte {
+	if e.format == SampleF32 {
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(x)))
+	}
+
+	bits := e.format.BytesPerSample() * 8
+	scale := float64(int64(1)<<(bits-1)) - 1.0
+	v := x * scale
+	if e.shaping {
+		// Feeding the last error back moves the noise to high frequencies
+		v -= e.errors[ch]
+	}
+	q := v
+	if e.dither {
+		// Triangular noise of ±1 LSB decorrelates the error from the signal
+		q += e.rng.Float64() - e.rng.Float64()
+	}
+	q = math.Round(q)
+	e.errors[ch] = q - v
+	q = math.Max(-scale-1.0, math.Min(scale, q))
+
+	switch bits {
+	case 24:
+		i := int32(q)
+		return append(buf, byte(i), byte(i>>8), byte(i>>16))
+	case 32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(int32(q)))
+	default:
+		return binary.LittleEndian.AppendUint16(buf, uint16(int16(q)))
+	}
+}
+
+// checkLayout validates the channel count and sample format of a stream
+func checkLayout(channels int, format SampleFormat) error {
+	if channels != 1 && channels != 2 {
+		return fmt.Errorf("only 1 or 2 channels are supported, not %d", channels)
+	}
+	if format < SampleS16 || format > SampleF32 {
+		return fmt.Errorf("unknown sample format %d", format)
+	}
+	return nil
+}
@@ -4,7 +4,7 @@ package audio
 
 import (
 	"io"
-	"unsafe"
+	"time"
 
 	"github.com/ebitengine/oto/v3"
 	"github.com/cjbrigato/go-vtm/tracker"
@@ -49,10 +49,13 @@ func NewAudioPlayback(module *tracker.TrackerModule, sampleRate int) (*AudioPlay
 
 // Play starts audio playback in a goroutine
 func (ap *AudioPlayback) Play() error {
+	renderer, err := NewRenderer(ap.player, RendererOptions{Format: SampleF32})
+	if err != nil {
+		return err
+	}
 	ap.audioPlayer = ap.otoContext.NewPlayer(&audioReader{
-		player:     ap.player,
-		sampleRate: ap.sampleRate,
-		done:       ap.done,
+		renderer: renderer,
+		done:     ap.done,
 	})
 
 	ap.audioPlayer.Play()
@@ -69,17 +72,58 @@ func (ap *AudioPlayback) IsPlaying() bool {
 	return ap.audioPlayer.IsPlaying()
 }
 
+// GetMixer returns the mixer of the playing module
+func (ap *AudioPlayback) GetMixer() *Mixer {
+	return ap.player.GetMixer()
+}
+
+// GetCompressor returns the master bus compressor
+func (ap *AudioPlayback) GetCompressor() *Compressor {
+	return ap.player.GetCompressor()
+}
+
+// GetLimiter returns the master bus limiter
+func (ap *AudioPlayback) GetLimiter() *Limiter {
+	return ap.player.GetLimiter()
+}
+
+// GetGainReduction returns the master bus gain reduction in dB
+func (ap *AudioPlayback) GetGainReduction() float64 {
+	return ap.player.GetGainReduction()
+}
+
 // IsDone returns true if the music has finished
 func (ap *AudioPlayback) IsDone() bool {
 	return ap.player.IsDone()
 }
 
+// Position returns the order, row and tick that are playing
+// It is the position being rendered, which runs ahead of what is heard by
+// the samples buffered in the audio device.
+func (ap *AudioPlayback) Position() (order, row, tick int) {
+	return ap.player.Position()
+}
+
+// Elapsed returns the playing time up to the current position
+// Like Position it runs ahead of what is heard by the buffered samples.
+func (ap *AudioPlayback) Elapsed() time.Duration {
+	return ap.player.Elapsed()
+}
+
+// Seek jumps to a row of an order in the sequence
+func (ap *AudioPlayback) Seek(order, row int) error {
+	return ap.player.Seek(order, row)
+}
+
+// SeekTime jumps to the row playing at a time from the start
+func (ap *AudioPlayback) SeekTime(t time.Duration) error {
+	return ap.player.SeekTime(t)
+}
+
 // audioReader implements io.Reader for audio streaming
 type audioReader struct {
-	player     *Player
-	sampleRate int
-	done       chan bool
-	buffer     []float32
+	renderer *Renderer // Stereo float32 samples, as the oto context expects
+	done     chan bool
 }
 
 // Read fills the buffer with audio samples
@@ -91,37 +135,5 @@ func (ar *audioReader) Read(p []byte) (n int, err error) {
 	default:
 	}
 
-	if ar.player.IsDone() {
-		return 0, io.EOF
-	}
-
-	// Convert byte slice to float32 samples
-	// Each float32 is 4 bytes, and we have 2 channels (stereo)
-	numSamples := len(p) / 4 / 2
-
-	// Generate samples
-	for i := 0; i < numSamples; i++ {
-		sample := float32(ar.player.Next())
-
-		// Convert to bytes (little-endian float32)
-		sampleBytes := float32ToBytes(sample)
-
-		// Write stereo (same sample for both channels)
-		offset := i * 8                         // 4 bytes per float32 * 2 channels
-		copy(p[offset:offset+4], sampleBytes)   // Left channel
-		copy(p[offset+4:offset+8], sampleBytes) // Right channel
-	}
-
-	return numSamples * 8, nil
-}
-
-// float32ToBytes converts a float32 to little-endian bytes
-func float32ToBytes(f float32) []byte {
-	bits := *(*uint32)(unsafe.Pointer(&f))
-	return []byte{
-		byte(bits),
-		byte(bits >> 8),
-		byte(bits >> 16),
-		byte(bits >> 24),
-	}
+	return ar.renderer.Read(p)
 }
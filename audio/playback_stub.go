@@ -2,13 +2,18 @@
 
 package audio
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/cjbrigato/go-vtm/tracker"
+)
 
 // AudioPlayback stub for unsupported platforms
 type AudioPlayback struct{}
 
 // NewAudioPlayback returns an error on unsupported platforms
-func NewAudioPlayback(module *TrackerModule, sampleRate int) (*AudioPlayback, error) {
+func NewAudioPlayback(module *tracker.TrackerModule, sampleRate int) (*AudioPlayback, error) {
 	return nil, fmt.Errorf("audio playback not supported on this platform")
 }
 
@@ -20,7 +25,52 @@ func (ap *AudioPlayback) Play() error {
 // Stop is a no-op
 func (ap *AudioPlayback) Stop() {}
 
+// IsPlaying returns false
+func (ap *AudioPlayback) IsPlaying() bool {
+	return false
+}
+
+// GetMixer returns nil
+func (ap *AudioPlayback) GetMixer() *Mixer {
+	return nil
+}
+
+// GetCompressor returns nil
+func (ap *AudioPlayback) GetCompressor() *Compressor {
+	return nil
+}
+
+// GetLimiter returns nil
+func (ap *AudioPlayback) GetLimiter() *Limiter {
+	return nil
+}
+
+// GetGainReduction returns 0
+func (ap *AudioPlayback) GetGainReduction() float64 {
+	return 0.0
+}
+
 // IsDone returns true
 func (ap *AudioPlayback) IsDone() bool {
 	return true
 }
+
+// Position returns 0, 0, 0
+func (ap *AudioPlayback) Position() (order, row, tick int) {
+	return 0, 0, 0
+}
+
+// Elapsed returns 0
+func (ap *AudioPlayback) Elapsed() time.Duration {
+	return 0
+}
+
+// Seek returns an error on unsupported platforms
+func (ap *AudioPlayback) Seek(order, row int) error {
+	return fmt.Errorf("audio playback not supported on this platform")
+}
+
+// SeekTime returns an error on unsupported platforms
+func (ap *AudioPlayback) SeekTime(t time.Duration) error {
+	return fmt.Errorf("audio playback not supported on this platform")
+}
@@ -1,25 +1,52 @@
 package audio
 
 import (
+	"math"
+	"sync"
+
 	"github.com/cjbrigato/go-vtm/synth"
 	"github.com/cjbrigato/go-vtm/tracker"
 )
 
 // Player plays tracker modules
+// Rendering, the playback position and seeking are guarded by a mutex, so
+// the position can be read and changed while audio is playing.
 type Player struct {
+	mu              sync.Mutex
 	module          *tracker.TrackerModule
 	VoiceAllocators []*VoiceAllocator // One allocator per channel for polyphony - PUBLIC for direct access
 	sampleRate      float64
-	currentPos      int // Position in sequence
-	currentRow      int // Current row in pattern
-	sampleCounter   int // Sample counter for row timing
-	samplesPerRow   int // Samples before advancing to next row
+	currentPos      int            // Position in sequence
+	currentRow      int            // Current row in pattern
+	sampleCounter   int            // Sample counter for row timing
+	samplesPerRow   int            // Samples before advancing to next row
+	ticksPerRow     int            // Effect ticks per row
+	samplesPerTick  int            // Samples between effect ticks
+	channels        []channelState // Effect state per channel
+	mixer           *Mixer         // Channel levels and master gain
+	compressor      *Compressor    // Optional master bus compression
+	limiter         *Limiter       // Keeps the master bus under its ceiling
 	done            bool
-	maxPolyphony    int // Max simultaneous notes per channel
+	maxPolyphony    int                   // Max simultaneous notes per channel
+	startInstrument []*tracker.Instrument // Instrument of each channel before the first row
+}
+
+// PlayerOptions configures the channel layout of a Player
+// Zero values fall back to the module's CHANNELS and POLYPHONY directives,
+// then to the widest pattern and chord (at least 8 channels of 4 voices).
+type PlayerOptions struct {
+	Channels         int              // Number of channels
+	VoicesPerChannel int              // Max simultaneous notes per channel
+	VoiceSteal       VoiceStealPolicy // Voice reuse when a row has more notes than a channel has voices
 }
 
 // NewPlayer creates a new tracker player
 func NewPlayer(module *tracker.TrackerModule, sampleRate float64) *Player {
+	return NewPlayerWithOptions(module, sampleRate, PlayerOptions{})
+}
+
+// NewPlayerWithOptions creates a new tracker player with a custom channel layout
+func NewPlayerWithOptions(module *tracker.TrackerModule, sampleRate float64, options PlayerOptions) *Player {
 	// Calculate samples per row based on tempo
 	// tempo = beats per minute
 	// 1 beat = 4 rows (typically)
@@ -29,9 +56,44 @@ func NewPlayer(module *tracker.TrackerModule, sampleRate float64) *Player {
 	secondsPerRow := secondsPerBeat / 4.0 // 4 rows per beat
 	samplesPerRow := int(secondsPerRow * samplesPerSecond)
 
-	// Create voice allocators (max 8 channels, 4 voices per channel for polyphony)
-	numChannels := 8
-	maxPolyphony := 4 // Allow up to 4 simultaneous notes per channel
+	// Each row is split into ticks for effect processing
+	ticksPerRow := module.TicksPerRow
+	if ticksPerRow <= 0 {
+		ticksPerRow = 6
+	}
+	samplesPerTick := samplesPerRow / ticksPerRow
+	if samplesPerTick < 1 {
+		samplesPerTick = 1
+	}
+
+	// Create voice allocators (8 channels of 4 voices unless the module needs more)
+	// Sizes taken from the module stay within the limits the parser enforces,
+	// in case the module was built in code.
+	numChannels := options.Channels
+	if numChannels <= 0 {
+		numChannels = min(module.Channels, tracker.MaxChannels)
+	}
+	if numChannels <= 0 {
+		numChannels = 8
+		for _, pattern := range module.Patterns {
+			numChannels = max(numChannels, min(len(pattern.Channels), tracker.MaxChannels))
+		}
+	}
+
+	maxPolyphony := options.VoicesPerChannel
+	if maxPolyphony <= 0 {
+		maxPolyphony = min(module.Polyphony, tracker.MaxVoices)
+	}
+	if maxPolyphony <= 0 {
+		maxPolyphony = 4
+		for _, pattern := range module.Patterns {
+			for _, channel := range pattern.Channels {
+				for _, note := range channel {
+					maxPolyphony = max(maxPolyphony, min(len(note.Chord)+1, tracker.MaxVoices))
+				}
+			}
+		}
+	}
 
 	voiceAllocators := make([]*VoiceAllocator, numChannels)
 
@@ -55,9 +117,13 @@ func NewPlayer(module *tracker.TrackerModule, sampleRate float64) *Player {
 			inst = &defaultInst
 		}
 		voiceAllocators[i] = NewVoiceAllocator(inst, sampleRate, maxPolyphony)
+		voiceAllocators[i].SetStealPolicy(options.VoiceSteal)
+		voiceAllocators[i].SetTempo(float64(module.Tempo))
+		// Independent noise on every voice of every channel
+		voiceAllocators[i].SetSeed(synth.DefaultNoiseSeed + uint64(i)<<16)
 	}
 
-	return &Player{
+	player := &Player{
 		module:          module,
 		VoiceAllocators: voiceAllocators,
 		sampleRate:      sampleRate,
@@ -65,30 +131,81 @@ func NewPlayer(module *tracker.TrackerModule, sampleRate float64) *Player {
 		currentRow:      0,
 		sampleCounter:   0,
 		samplesPerRow:   samplesPerRow,
+		ticksPerRow:     ticksPerRow,
+		samplesPerTick:  samplesPerTick,
 		done:            false,
 		maxPolyphony:    maxPolyphony,
+		mixer:           NewMixer(numChannels),
+		compressor:      NewCompressor(sampleRate),
+		limiter:         NewLimiter(sampleRate),
+	}
+	player.resetChannels()
+	for _, allocator := range voiceAllocators {
+		player.startInstrument = append(player.startInstrument, allocator.GetInstrument())
+	}
+
+	return player
+}
+
+// resetChannels clears the effect state of every channel
+func (p *Player) resetChannels() {
+	p.channels = make([]channelState, len(p.VoiceAllocators))
+	for i := range p.channels {
+		p.channels[i] = newChannelState(p.maxPolyphony)
+		if i < len(p.module.Panning) {
+			p.channels[i].pan = p.module.Panning[i]
+		}
 	}
 }
 
 // Next generates the next audio sample (mono)
 func (p *Player) Next() float64 {
+	return downmix(p.NextStereo())
+}
+
+// downmix mixes a stereo sample to mono
+func downmix(left, right float64) float64 {
+	// Centered channels sit at -3dB on each side, so this restores their level
+	return (left + right) * math.Sqrt2 / 2.0
+}
+
+// NextStereo generates the next audio sample with each channel panned
+// using a constant-power pan law
+func (p *Player) NextStereo() (left, right float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.nextStereo()
+}
+
+// nextStereo generates the next stereo sample, with p.mu held
+func (p *Player) nextStereo() (left, right float64) {
 	if p.done {
-		return 0.0
+		return 0.0, 0.0
 	}
 
-	// Check if we need to process a new row
+	// Check if we need to process a new row or effect tick
 	if p.sampleCounter == 0 {
 		p.processRow()
+	} else if p.sampleCounter%p.samplesPerTick == 0 {
+		if tick := p.sampleCounter / p.samplesPerTick; tick < p.ticksPerRow {
+			p.processTick(tick)
+		}
 	}
 
 	// Generate audio by mixing all channels
-	var sample float64
-	for _, allocator := range p.VoiceAllocators {
-		sample += allocator.Next()
+	gains := p.mixer.channelGains()
+	for ch, allocator := range p.VoiceAllocators {
+		sample := allocator.Next() * gains[ch]
+
+		pan := math.Max(-1.0, math.Min(1.0, p.channels[ch].pan+p.channels[ch].envPan))
+		angle := (pan + 1.0) * math.Pi / 4.0
+		left += sample * math.Cos(angle)
+		right += sample * math.Sin(angle)
 	}
 
-	// Simple mixing (average)
-	sample /= float64(len(p.VoiceAllocators))
+	// Master bus dynamics
+	left, right = p.compressor.Process(left, right)
+	left, right = p.limiter.Process(left, right)
 
 	// Advance sample counter
 	p.sampleCounter++
@@ -99,7 +216,7 @@ func (p *Player) Next() float64 {
 		// Check if we've finished the current pattern
 		if p.currentPos < len(p.module.Sequence) {
 			patternIdx := p.module.Sequence[p.currentPos]
-			if patternIdx < len(p.module.Patterns) {
+			if patternIdx >= 0 && patternIdx < len(p.module.Patterns) {
 				if p.currentRow >= p.module.Patterns[patternIdx].Rows {
 					p.currentRow = 0
 					p.currentPos++
@@ -113,7 +230,7 @@ func (p *Player) Next() float64 {
 		}
 	}
 
-	return sample
+	return left, right
 }
 
 // processRow processes the current row and triggers notes
@@ -123,59 +240,89 @@ func (p *Player) processRow() {
 	}
 
 	patternIdx := p.module.Sequence[p.currentPos]
-	if patternIdx >= len(p.module.Patterns) {
+	if patternIdx < 0 || patternIdx >= len(p.module.Patterns) {
 		return
 	}
 
 	pattern := p.module.Patterns[patternIdx]
 
 	// Process each channel
-	for ch := 0; ch < len(pattern.Channels) && ch < len(p.VoiceAllocators); ch++ {
-		if p.currentRow < len(pattern.Channels[ch]) {
-			note := pattern.Channels[ch][p.currentRow]
-
-			if note.Note >= 0 {
-				// Trigger note with proper velocity
-				velocity := note.Volume
-				if velocity == 0 {
-					velocity = 1.0 // Default velocity if not specified
-				}
+	for ch := range p.VoiceAllocators {
+		cs := &p.channels[ch]
+		// Channels the pattern does not cover drop the effect of the last row
+		if ch >= len(pattern.Channels) || p.currentRow >= len(pattern.Channels[ch]) {
+			cs.setEffect("")
+			continue
+		}
+		note := pattern.Channels[ch][p.currentRow]
+		cs.setEffect(note.Effect)
+
+		if note.Note >= 0 {
+			// Trigger note with proper velocity (v00 is a silent note)
+			velocity := note.Volume
 
-				// For voice-per-line format, use direct voice control
-				// Voice 0 gets the main note
-				voice0 := p.VoiceAllocators[ch].GetVoice(0)
-				if voice0 != nil {
-					voice0.NoteOn(note.Note, velocity)
+			// Voice 0 gets the main note, chord notes go on voices 1, 2, 3...
+			allocator := p.VoiceAllocators[ch]
+			voice0 := allocator.GetVoice(cs.slot(0))
+			if cs.effect == tracker.EffectTonePorta && cs.notes[0] >= 0 && voice0 != nil && voice0.IsActive() {
+				// Tone portamento slides to the new note instead of retriggering
+				cs.portaTarget = float64(note.Note - cs.notes[0])
+			} else {
+				// Instrument numbers are 1-based, 0 keeps the current one
+				if note.Instrument > 0 && note.Instrument <= len(p.module.Instruments) {
+					allocator.SetInstrument(&p.module.Instruments[note.Instrument-1])
 				}
+				p.triggerVoice(ch, 0, note.Note, velocity)
+				cs.startEnvelopes(allocator.GetInstrument())
+			}
 
-				// If this is a chord, trigger additional notes on specific voices
-				if note.Chord != nil && len(note.Chord) > 0 {
-					for voiceIdx, chordNote := range note.Chord {
-						if chordNote >= 0 {
-							// Trigger on voices 1, 2, 3
-							voice := p.VoiceAllocators[ch].GetVoice(voiceIdx + 1)
-							if voice != nil {
-								voice.NoteOn(chordNote, velocity)
-							}
-						} else if chordNote == -2 {
-							// Note-off for this specific voice
-							voice := p.VoiceAllocators[ch].GetVoice(voiceIdx + 1)
-							if voice != nil {
-								voice.NoteOff()
-							}
+			// If this is a chord, trigger additional notes on specific voices
+			if note.Chord != nil && len(note.Chord) > 0 {
+				for voiceIdx, chordNote := range note.Chord {
+					if chordNote >= 0 {
+						// Voice lines may give each chord note its own velocity
+						chordVelocity := velocity
+						if voiceIdx < len(note.ChordVolume) {
+							chordVelocity = note.ChordVolume[voiceIdx]
 						}
-						// -3 is sustain, do nothing (let note keep playing)
+						p.triggerVoice(ch, voiceIdx+1, chordNote, chordVelocity)
+					} else if chordNote == -2 {
+						// Note-off for this specific voice
+						p.releaseVoice(ch, voiceIdx+1)
 					}
-				}
-			} else if note.Note == -2 {
-				// Note off command for voice 0
-				voice0 := p.VoiceAllocators[ch].GetVoice(0)
-				if voice0 != nil {
-					voice0.NoteOff()
+					// -3 is sustain, do nothing (let note keep playing)
 				}
 			}
-			// -1 is rest (silence), -3 is sustain (continue playing previous note)
+		} else if note.Note == -2 {
+			// Note off command for voice 0
+			p.releaseVoice(ch, 0)
+			cs.releaseEnvelopes()
 		}
+		// -1 is rest (silence), -3 is sustain (continue playing previous note)
+	}
+
+	p.processTick(0)
+}
+
+// triggerVoice plays a note on a pattern voice of a channel
+// A pattern voice keeps the allocator voice it was given, so retriggers stay
+// on the same synth voice; new ones are allocated with the voice-steal policy.
+func (p *Player) triggerVoice(ch, voice, note int, velocity float64) {
+	cs := &p.channels[ch]
+	allocator := p.VoiceAllocators[ch]
+	slot := cs.slot(voice)
+	if slot >= 0 {
+		allocator.SetVoiceNote(slot, note, velocity)
+	} else {
+		slot = allocator.allocate(note, velocity)
+	}
+	cs.noteOn(voice, slot, note, velocity)
+}
+
+// releaseVoice sends a note-off to a pattern voice of a channel
+func (p *Player) releaseVoice(ch, voice int) {
+	if slot := p.channels[ch].slot(voice); slot >= 0 {
+		p.VoiceAllocators[ch].ReleaseVoice(slot)
 	}
 }
 
@@ -193,6 +340,47 @@ func (p *Player) GetChannelCount() int {
 	return len(p.VoiceAllocators)
 }
 
+// GetMixer returns the mixer, whose settings can be changed during playback
+func (p *Player) GetMixer() *Mixer {
+	return p.mixer
+}
+
+// GetCompressor returns the master bus compressor (disabled by default)
+func (p *Player) GetCompressor() *Compressor {
+	return p.compressor
+}
+
+// GetLimiter returns the master bus limiter
+func (p *Player) GetLimiter() *Limiter {
+	return p.limiter
+}
+
+// GetGainReduction returns the total master bus gain reduction in dB,
+// for metering
+func (p *Player) GetGainReduction() float64 {
+	return p.compressor.GetGainReduction() + p.limiter.GetGainReduction()
+}
+
+// SetChannelGain sets the linear gain of a channel
+func (p *Player) SetChannelGain(channel int, gain float64) {
+	p.mixer.SetChannelGain(channel, gain)
+}
+
+// SetChannelMute mutes or unmutes a channel
+func (p *Player) SetChannelMute(channel int, muted bool) {
+	p.mixer.SetChannelMute(channel, muted)
+}
+
+// SetChannelSolo solos or unsolos a channel
+func (p *Player) SetChannelSolo(channel int, soloed bool) {
+	p.mixer.SetChannelSolo(channel, soloed)
+}
+
+// SetMasterGain sets the linear gain of the master bus
+func (p *Player) SetMasterGain(gain float64) {
+	p.mixer.SetMasterGain(gain)
+}
+
 // GetMaxPolyphony returns the max voices per channel
 func (p *Player) GetMaxPolyphony() int {
 	return p.maxPolyphony
@@ -200,27 +388,32 @@ func (p *Player) GetMaxPolyphony() int {
 
 // IsDone returns true if playback is complete
 func (p *Player) IsDone() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.done
 }
 
 // Reset resets the player to the beginning
+// Sounding notes are released and each channel gets back its starting
+// instrument, as with Seek(0, 0).
 func (p *Player) Reset() {
-	p.currentPos = 0
-	p.currentRow = 0
-	p.sampleCounter = 0
-	p.done = false
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seek(0, 0)
+	p.compressor.Reset()
+	p.limiter.Reset()
 }
 
 // Stream implements a simple audio stream interface
 func (p *Player) Stream(samples [][2]float64) (n int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for i := range samples {
 		if p.done {
 			return i, false
 		}
 
-		sample := p.Next()
-		samples[i][0] = sample // Left channel
-		samples[i][1] = sample // Right channel (mono for now)
+		samples[i][0], samples[i][1] = p.nextStereo()
 	}
 	return len(samples), true
 }
@@ -0,0 +1,129 @@
+package audio
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cjbrigato/go-vtm/tracker"
+)
+
+// Position returns the order in the sequence, the row in its pattern and the
+// effect tick within the row that is playing
+// This is where rendering is, the next sample NextStereo returns comes from
+// it. Once playback is done the order is the length of the sequence.
+func (p *Player) Position() (order, row, tick int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tick = min(p.sampleCounter/p.samplesPerTick, p.ticksPerRow-1)
+	return p.currentPos, p.currentRow, tick
+}
+
+// Elapsed returns the playing time from the start of the sequence to the
+// current position
+// Like Position it counts the samples rendered, not those heard.
+func (p *Player) Elapsed() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rows := p.currentRow
+	for order := 0; order < p.currentPos && order < len(p.module.Sequence); order++ {
+		rows += p.orderRows(order)
+	}
+	return p.samplesToDuration(rows*p.samplesPerRow + p.sampleCounter)
+}
+
+// Seek jumps to a row of an order in the sequence
+// Sounding notes are released and effects are cleared, and each channel
+// gets the instrument it would have had when playing up to that row.
+func (p *Player) Seek(order, row int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if order < 0 || order >= len(p.module.Sequence) {
+		return fmt.Errorf("order %d out of range (sequence has %d)", order, len(p.module.Sequence))
+	}
+	if rows := p.orderRows(order); row < 0 || row >= rows {
+		return fmt.Errorf("row %d out of range (order %d has %d rows)", row, order, rows)
+	}
+	p.seek(order, row)
+	return nil
+}
+
+// SeekTime jumps to the row that is playing at a time from the start of the
+// sequence
+func (p *Player) SeekTime(t time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t < 0 {
+		return fmt.Errorf("negative seek time %v", t)
+	}
+	row := int(t.Seconds()*p.sampleRate) / p.samplesPerRow
+	for order := range p.module.Sequence {
+		rows := p.orderRows(order)
+		if row < rows {
+			p.seek(order, row)
+			return nil
+		}
+		row -= rows
+	}
+	return fmt.Errorf("seek time %v is past the end of the module", t)
+}
+
+// seek moves to a valid position, with p.mu held
+func (p *Player) seek(order, row int) {
+	for _, allocator := range p.VoiceAllocators {
+		allocator.AllNotesOff()
+	}
+	p.resetChannels()
+	p.restoreInstruments(order, row)
+
+	p.currentPos = order
+	p.currentRow = row
+	p.sampleCounter = 0
+	p.done = false
+}
+
+// restoreInstruments selects on each channel the last instrument set before
+// a row, as processRow would have
+func (p *Player) restoreInstruments(order, row int) {
+	instruments := make([]*tracker.Instrument, len(p.VoiceAllocators))
+	copy(instruments, p.startInstrument)
+
+	for pos := 0; pos <= order && pos < len(p.module.Sequence); pos++ {
+		patternIdx := p.module.Sequence[pos]
+		if patternIdx < 0 || patternIdx >= len(p.module.Patterns) {
+			continue
+		}
+		pattern := p.module.Patterns[patternIdx]
+		for ch := 0; ch < len(pattern.Channels) && ch < len(instruments); ch++ {
+			notes := pattern.Channels[ch]
+			if pos == order {
+				notes = notes[:min(row, len(notes))]
+			}
+			for _, note := range notes {
+				if note.Note >= 0 && note.Instrument > 0 && note.Instrument <= len(p.module.Instruments) {
+					instruments[ch] = &p.module.Instruments[note.Instrument-1]
+				}
+			}
+		}
+	}
+
+	for ch, allocator := range p.VoiceAllocators {
+		allocator.SetInstrument(instruments[ch])
+	}
+}
+
+// orderRows returns the number of rows of the pattern at an order
+func (p *Player) orderRows(order int) int {
+	patternIdx := p.module.Sequence[order]
+	if patternIdx < 0 || patternIdx >= len(p.module.Patterns) {
+		return 0
+	}
+	return p.module.Patterns[patternIdx].Rows
+}
+
+// samplesToDuration converts a number of output samples to a duration
+func (p *Player) samplesToDuration(samples int) time.Duration {
+	return time.Duration(float64(samples) / p.sampleRate * float64(time.Second))
+}
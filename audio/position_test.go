@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+// positionSong has 500 samples per row at 8000 Hz, and orders of 4, 2 and
+// 4 rows
+const positionSong = `TEMPO 240
+TICKS 5
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+PATTERN 4 1
+CH 0: C-4
+ENDPATTERN
+PATTERN 2 1
+CH 0: E-4
+ENDPATTERN
+SEQUENCE 0 1 0
+`
+
+func TestSeekPosition(t *testing.T) {
+	const rowTime = time.Second / 16
+
+	tests := []struct {
+		order, row int
+		wantErr    bool
+		elapsed    time.Duration
+	}{
+		{order: 0, row: 0, elapsed: 0},
+		{order: 0, row: 3, elapsed: 3 * rowTime},
+		{order: 1, row: 0, elapsed: 4 * rowTime},
+		{order: 1, row: 1, elapsed: 5 * rowTime},
+		{order: 2, row: 2, elapsed: 8 * rowTime},
+		{order: 1, row: 2, wantErr: true},
+		{order: 3, row: 0, wantErr: true},
+		{order: -1, row: 0, wantErr: true},
+		{order: 0, row: -1, wantErr: true},
+	}
+
+	player := NewPlayer(loadModule(t, positionSong), 8000)
+	for _, tt := range tests {
+		err := player.Seek(tt.order, tt.row)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Seek(%d, %d) succeeded", tt.order, tt.row)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Seek(%d, %d): %v", tt.order, tt.row, err)
+			continue
+		}
+		if order, row, tick := player.Position(); order != tt.order || row != tt.row || tick != 0 {
+			t.Errorf("after Seek(%d, %d) Position = %d, %d, %d", tt.order, tt.row, order, row, tick)
+		}
+		if elapsed := player.Elapsed(); elapsed != tt.elapsed {
+			t.Errorf("after Seek(%d, %d) Elapsed = %v, want %v", tt.order, tt.row, elapsed, tt.elapsed)
+		}
+
+		// SeekTime to the same time lands on the same row, as does any time
+		// within the row
+		for _, into := range []time.Duration{0, rowTime / 2, rowTime - time.Millisecond} {
+			if err := player.SeekTime(tt.elapsed + into); err != nil {
+				t.Errorf("SeekTime(%v): %v", tt.elapsed+into, err)
+			}
+			if order, row, _ := player.Position(); order != tt.order || row != tt.row {
+				t.Errorf("SeekTime(%v) went to %d, %d, want %d, %d", tt.elapsed+into, order, row, tt.order, tt.row)
+			}
+		}
+	}
+
+	if err := player.SeekTime(10 * rowTime); err == nil {
+		t.Error("SeekTime past the end succeeded")
+	}
+	if err := player.SeekTime(-time.Millisecond); err == nil {
+		t.Error("SeekTime before the start succeeded")
+	}
+}
+
+func TestPositionAdvances(t *testing.T) {
+	player := NewPlayer(loadModule(t, positionSong), 8000)
+	if err := player.Seek(0, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stepping through order 0 row 3 into order 1, one tick at a time
+	tests := []struct {
+		samples          int // Rendered since the seek
+		order, row, tick int
+	}{
+		{0, 0, 3, 0},
+		{99, 0, 3, 0},
+		{100, 0, 3, 1},
+		{499, 0, 3, 4},
+		{500, 1, 0, 0},
+		{750, 1, 0, 2},
+		{1000, 1, 1, 0},
+	}
+
+	rendered := 0
+	for _, tt := range tests {
+		for ; rendered < tt.samples; rendered++ {
+			player.NextStereo()
+		}
+		if order, row, tick := player.Position(); order != tt.order || row != tt.row || tick != tt.tick {
+			t.Errorf("after %d samples Position = %d, %d, %d, want %d, %d, %d",
+				tt.samples, order, row, tick, tt.order, tt.row, tt.tick)
+		}
+		want := time.Duration(3*500+tt.samples) * time.Second / 8000
+		if elapsed := player.Elapsed(); elapsed != want {
+			t.Errorf("after %d samples Elapsed = %v, want %v", tt.samples, elapsed, want)
+		}
+	}
+
+	// Playing to the end leaves the order past the sequence
+	for !player.IsDone() {
+		player.NextStereo()
+	}
+	if order, _, _ := player.Position(); order != 3 {
+		t.Errorf("when done Position order = %d, want 3", order)
+	}
+}
+
+func TestMissingPatternInSequence(t *testing.T) {
+	// Modules built in code may refer to patterns that do not exist, which
+	// play silence instead of panicking
+	module := loadModule(t, positionSong)
+	for _, sequence := range [][]int{{-1, 0}, {5, 0}} {
+		module.Sequence = sequence
+		player := NewPlayer(module, 8000)
+		for range 1000 {
+			if left, right := player.NextStereo(); left != 0 || right != 0 {
+				t.Fatalf("sequence %v plays sound", sequence)
+			}
+		}
+	}
+}
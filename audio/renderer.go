@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"io"
+)
+
+// RendererOptions configures the PCM stream of a Renderer
+type RendererOptions struct {
+	Channels int          // 1 (mono) or 2 (interleaved stereo, the default)
+	Format   SampleFormat // SampleS16 (s16le) by default, SampleF32 for f32le
+	NoDither bool         // Round integer formats without TPDF dither
+}
+
+// Renderer streams a Player as raw little-endian PCM through io.Reader,
+// to pipe it to ffmpeg, feed another audio engine or send it over the network
+// Read returns io.EOF once the module has finished.
+type Renderer struct {
+	player  *Player
+	opts    RendererOptions
+	encoder *sampleEncoder
+	frame   []byte // Encoding buffer of the last frame
+	pending []byte // Part of the last frame that did not fit in a Read
+}
+
+// NewRenderer creates a renderer that reads samples from player
+func NewRenderer(player *Player, opts RendererOptions) (*Renderer, error) {
+	if opts.Channels == 0 {
+		opts.Channels = 2
+	}
+	if err := checkLayout(opts.Channels, opts.Format); err != nil {
+		return nil, err
+	}
+
+	return &Renderer{
+		player:  player,
+		opts:    opts,
+		encoder: newSampleEncoder(opts.Format, !opts.NoDither, false),
+	}, nil
+}
+
+// GetPlayer returns the player being rendered
+func (r *Renderer) GetPlayer() *Player {
+	return r.player
+}
+
+// GetBytesPerFrame returns the size of one frame of every channel
+func (r *Renderer) GetBytesPerFrame() int {
+	return r.opts.Channels * r.opts.Format.BytesPerSample()
+}
+
+// Read fills p with rendered frames
+// Frames are split across calls when p is not a multiple of the frame size.
+func (r *Renderer) Read(p []byte) (n int, err error) {
+	// Hold the player for the whole buffer rather than for every frame
+	r.player.mu.Lock()
+	defer r.player.mu.Unlock()
+
+	for n < len(p) {
+		if len(r.pending) == 0 {
+			if r.player.done {
+				break
+			}
+			r.frame = r.nextFrame(r.frame[:0])
+			r.pending = r.frame
+		}
+		copied := copy(p[n:], r.pending)
+		r.pending = r.pending[copied:]
+		n += copied
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// nextFrame renders one frame and appends it to buf, with the player locked
+func (r *Renderer) nextFrame(buf []byte) []byte {
+	left, right := r.player.nextStereo()
+	if r.opts.Channels == 1 {
+		return r.encoder.appendSample(buf, downmix(left, right), 0)
+	}
+	buf = r.encoder.appendSample(buf, left, 0)
+	return r.encoder.appendSample(buf, right, 1)
+}
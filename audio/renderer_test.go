@@ -0,0 +1,121 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestRendererPartialReads(t *testing.T) {
+	// Read sizes that split frames of every layout in different places
+	sizes := []int{1, 3, 5, 7, 13, 64, 1001}
+
+	for _, format := range []SampleFormat{SampleS16, SampleS24, SampleS32, SampleF32} {
+		for _, channels := range []int{1, 2} {
+			opts := RendererOptions{Channels: channels, Format: format}
+			renderer := func() *Renderer {
+				r, err := NewRenderer(NewPlayer(loadModule(t, positionSong), 8000), opts)
+				if err != nil {
+					t.Fatalf("NewRenderer(%+v): %v", opts, err)
+				}
+				return r
+			}
+
+			whole, err := io.ReadAll(renderer())
+			if err != nil {
+				t.Fatalf("%+v: %v", opts, err)
+			}
+			frameSize := channels * format.BytesPerSample()
+			if len(whole) == 0 || len(whole)%frameSize != 0 {
+				t.Fatalf("%+v: read %d bytes, not whole %d-byte frames", opts, len(whole), frameSize)
+			}
+
+			r := renderer()
+			var parts []byte
+			for i := 0; ; i++ {
+				buf := make([]byte, sizes[i%len(sizes)])
+				n, err := r.Read(buf)
+				parts = append(parts, buf[:n]...)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%+v: read %d: %v", opts, i, err)
+				}
+			}
+
+			if len(parts) != len(whole) {
+				t.Fatalf("%+v: partial reads gave %d bytes, want %d", opts, len(parts), len(whole))
+			}
+			for i := range whole {
+				if parts[i] != whole[i] {
+					t.Fatalf("%+v: partial reads differ at byte %d", opts, i)
+				}
+			}
+		}
+	}
+}
+
+func TestRendererFrames(t *testing.T) {
+	r, err := NewRenderer(NewPlayer(loadModule(t, positionSong), 8000), RendererOptions{Format: SampleF32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Float frames hold the player's interleaved stereo samples as they are
+	player := NewPlayer(loadModule(t, positionSong), 8000)
+	frames := 0
+	for ; !player.IsDone(); frames++ {
+		left, right := player.NextStereo()
+		for i, want := range []float64{left, right} {
+			offset := frames*8 + i*4
+			if offset+4 > len(data) {
+				t.Fatalf("rendered %d frames, want more", frames)
+			}
+			got := math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
+			if got != float32(want) {
+				t.Fatalf("frame %d channel %d = %f, want %f", frames, i, got, want)
+			}
+		}
+	}
+	if len(data) != frames*8 {
+		t.Errorf("rendered %d bytes, want %d frames of 8", len(data), frames)
+	}
+}
+
+func TestRendererOptions(t *testing.T) {
+	tests := []struct {
+		opts      RendererOptions
+		frameSize int
+		wantErr   bool
+	}{
+		{opts: RendererOptions{}, frameSize: 4},
+		{opts: RendererOptions{Channels: 1, Format: SampleS24}, frameSize: 3},
+		{opts: RendererOptions{Channels: 2, Format: SampleF32}, frameSize: 8},
+		{opts: RendererOptions{Channels: 3}, wantErr: true},
+		{opts: RendererOptions{Format: SampleFormat(9)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r, err := NewRenderer(NewPlayer(loadModule(t, positionSong), 8000), tt.opts)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewRenderer(%+v) succeeded", tt.opts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewRenderer(%+v): %v", tt.opts, err)
+			continue
+		}
+		if got := r.GetBytesPerFrame(); got != tt.frameSize {
+			t.Errorf("NewRenderer(%+v) frames are %d bytes, want %d", tt.opts, got, tt.frameSize)
+		}
+	}
+}
@@ -5,113 +5,256 @@ import (
 	"github.com/cjbrigato/go-vtm/tracker"
 )
 
+// VoiceStealPolicy decides which voice a full channel reuses for a new note
+type VoiceStealPolicy int
+
+const (
+	StealOldest VoiceStealPolicy = iota // Replace the note that started first
+	StealLowest                         // Replace the lowest note, keeping the melody on top
+	StealNone                           // Drop the new note
+)
+
 // VoiceAllocator manages polyphonic voice allocation for a channel
 type VoiceAllocator struct {
-	voices     []*synth.Voice
-	noteMap    map[int]*synth.Voice // Maps note number to voice
-	instrument *tracker.Instrument
-	sampleRate float64
-	maxVoices  int
-	activeNotes []int // Track which notes are currently active
+	voices           []*synth.Voice
+	voiceInstruments []*tracker.Instrument // Instrument each voice was built for
+	noteMap          map[int]*synth.Voice  // Maps note number to voice
+	instrument       *tracker.Instrument   // Instrument used for new notes
+	sampleRate       float64
+	maxVoices        int
+	stealPolicy      VoiceStealPolicy
+	tempo            float64 // BPM for tempo-synced LFOs (0 = voice default)
+	seed             uint64  // Noise seed of the first voice, the others follow it
+	activeNotes      []int   // Track which notes are currently active
 }
 
 // NewVoiceAllocator creates a voice allocator with max polyphony
 func NewVoiceAllocator(instrument *tracker.Instrument, sampleRate float64, maxVoices int) *VoiceAllocator {
 	voices := make([]*synth.Voice, maxVoices)
-	
+	voiceInstruments := make([]*tracker.Instrument, maxVoices)
+
 	// Create voices based on instrument type
 	for i := range voices {
-		if instrument.IsFM {
-			// Create FM instrument
-			var fmInst *synth.FMInstrument
-			switch instrument.FMPreset {
-			case "PIANO":
-				fmInst = synth.NewPianoFMInstrument(sampleRate)
-			case "EPIANO":
-				fmInst = synth.NewElectricPianoFMInstrument(sampleRate)
-			case "BASS":
-				fmInst = synth.NewFMBassFMInstrument(sampleRate)
-			case "LEAD":
-				fmInst = synth.NewFMLeadFMInstrument(sampleRate)
-			case "BRASS":
-				fmInst = synth.NewFMBrassFMInstrument(sampleRate)
-			case "BELL":
-				fmInst = synth.NewFMBellFMInstrument(sampleRate)
-			case "ARP":
-				fmInst = synth.NewFMArpFMInstrument(sampleRate)
-			default:
-				fmInst = synth.NewFMLeadFMInstrument(sampleRate)
-			}
-			voices[i] = synth.NewFMVoice(fmInst)
-		} else {
-			// Traditional instrument
-			voices[i] = synth.NewVoice(instrument.WaveType, sampleRate)
-			voices[i].SetInstrument(instrument.WaveType, instrument.Attack, instrument.Decay, instrument.Sustain, instrument.Release)
-		}
+		voices[i] = newInstrumentVoice(instrument, sampleRate, 0, synth.DefaultNoiseSeed+uint64(i))
+		voiceInstruments[i] = instrument
 	}
-	
+
 	return &VoiceAllocator{
-		voices:      voices,
-		noteMap:     make(map[int]*synth.Voice),
-		instrument:  instrument,
-		sampleRate:  sampleRate,
-		maxVoices:   maxVoices,
-		activeNotes: make([]int, 0, maxVoices),
+		voices:           voices,
+		voiceInstruments: voiceInstruments,
+		noteMap:          make(map[int]*synth.Voice),
+		instrument:       instrument,
+		sampleRate:       sampleRate,
+		maxVoices:        maxVoices,
+		seed:             synth.DefaultNoiseSeed,
+		activeNotes:      make([]int, 0, maxVoices),
+	}
+}
+
+// newInstrumentVoice builds a synthesis voice for an instrument definition
+func newInstrumentVoice(instrument *tracker.Instrument, sampleRate, tempo float64, seed uint64) *synth.Voice {
+	voice := buildInstrumentVoice(instrument, sampleRate)
+	if tempo > 0 {
+		voice.SetTempo(tempo)
 	}
+	voice.SetSeed(seed)
+	return voice
+}
+
+// buildInstrumentVoice creates the FM, sample or oscillator voice of an instrument
+func buildInstrumentVoice(instrument *tracker.Instrument, sampleRate float64) *synth.Voice {
+	if instrument.IsFM {
+		// Create FM instrument, unknown presets fall back to LEAD
+		fmInst, ok := synth.NewFMPreset(instrument.FMPreset, sampleRate)
+		if !ok {
+			fmInst = synth.NewFMLeadFMInstrument(sampleRate)
+		}
+		// Parameters from the file override the preset, invalid ones are skipped
+		fmInst.ApplyParams(instrument.FMParams)
+		return synth.NewFMVoice(fmInst)
+	}
+
+	if instrument.SampleFile != "" {
+		// A sample that failed to load plays silence
+		sample := instrument.Sample
+		if sample == nil {
+			sample = &synth.Sample{SampleRate: sampleRate}
+		}
+		voice := synth.NewSampleVoice(sample, sampleRate)
+		voice.ApplyParams(instrument.Params)
+		return voice
+	}
+
+	// Traditional instrument
+	voice := synth.NewVoice(instrument.WaveType, sampleRate)
+	voice.SetInstrument(instrument.WaveType, instrument.Attack, instrument.Decay, instrument.Sustain, instrument.Release)
+	voice.ApplyParams(instrument.Params)
+	return voice
+}
+
+// SetInstrument switches the channel to another instrument.
+// Voices are rebuilt lazily when they are next triggered, so notes already
+// sounding keep their instrument until they are replaced.
+func (va *VoiceAllocator) SetInstrument(instrument *tracker.Instrument) {
+	if instrument != nil {
+		va.instrument = instrument
+	}
+}
+
+// SetStealPolicy sets how NoteOn picks a voice when all voices are busy
+func (va *VoiceAllocator) SetStealPolicy(policy VoiceStealPolicy) {
+	va.stealPolicy = policy
+}
+
+// SetTempo sets the tempo in BPM for LFOs synced to it
+func (va *VoiceAllocator) SetTempo(bpm float64) {
+	va.tempo = bpm
+	for _, voice := range va.voices {
+		voice.SetTempo(bpm)
+	}
+}
+
+// SetSeed restarts the noise of the voices from a seed, voice i getting
+// seed+i, so channels given seeds far enough apart never share noise
+func (va *VoiceAllocator) SetSeed(seed uint64) {
+	va.seed = seed
+	for i, voice := range va.voices {
+		voice.SetSeed(seed + uint64(i))
+	}
+}
+
+// GetInstrument returns the instrument new notes are played with
+func (va *VoiceAllocator) GetInstrument() *tracker.Instrument {
+	return va.instrument
+}
+
+// prepareVoice swaps the voice at index for the current instrument if needed
+func (va *VoiceAllocator) prepareVoice(index int) *synth.Voice {
+	if va.voiceInstruments[index] != va.instrument {
+		old := va.voices[index]
+		va.voices[index] = newInstrumentVoice(va.instrument, va.sampleRate, va.tempo, va.seed+uint64(index))
+		va.voiceInstruments[index] = va.instrument
+
+		// Keep the note map pointing at the live voice
+		for note, voice := range va.noteMap {
+			if voice == old {
+				va.noteMap[note] = va.voices[index]
+			}
+		}
+	}
+	return va.voices[index]
 }
 
 // NoteOn triggers a note (finds or allocates a voice)
 func (va *VoiceAllocator) NoteOn(note int, velocity float64) {
 	// If this note is already playing, restart it
 	if voice, exists := va.noteMap[note]; exists {
-		voice.NoteOn(note, velocity)
+		va.prepareVoice(va.voiceIndex(voice)).NoteOn(note, velocity)
 		return
 	}
-	
-	// Find an available voice
-	var selectedVoice *synth.Voice
-	
+	va.allocate(note, velocity)
+}
+
+// allocate triggers a note on a free or released voice, or on one taken
+// from another note according to the steal policy, and returns the voice
+// index (-1 if the note was dropped)
+func (va *VoiceAllocator) allocate(note int, velocity float64) int {
+	index := -1
+
 	// First, try to find an inactive voice
-	for _, voice := range va.voices {
+	for i, voice := range va.voices {
 		if !voice.IsActive() {
-			selectedVoice = voice
+			index = i
 			break
 		}
 	}
-	
-	// If no inactive voice, steal the oldest one
-	if selectedVoice == nil {
-		// Steal the first note in activeNotes (oldest)
+
+	// Then for a voice fading out after its note-off
+	if index < 0 {
+		for i, voice := range va.voices {
+			if !va.isTracked(voice) {
+				index = i
+				break
+			}
+		}
+	}
+
+	// If every voice holds a note, steal one according to the policy
+	if index < 0 {
 		if len(va.activeNotes) > 0 {
-			oldestNote := va.activeNotes[0]
-			selectedVoice = va.noteMap[oldestNote]
-			delete(va.noteMap, oldestNote)
-			// Remove from activeNotes
-			va.activeNotes = va.activeNotes[1:]
+			if va.stealPolicy == StealNone {
+				return -1
+			}
+
+			// activeNotes is in trigger order, so the oldest note is first
+			victim := 0
+			if va.stealPolicy == StealLowest {
+				for i, n := range va.activeNotes {
+					if n < va.activeNotes[victim] {
+						victim = i
+					}
+				}
+			}
+			index = va.voiceIndex(va.noteMap[va.activeNotes[victim]])
 		} else {
 			// Fallback: use first voice
-			selectedVoice = va.voices[0]
+			index = 0
 		}
 	}
-	
+
 	// Trigger the voice
-	selectedVoice.NoteOn(note, velocity)
-	va.noteMap[note] = selectedVoice
+	va.untrackVoice(index)
+	va.prepareVoice(index).NoteOn(note, velocity)
+	va.trackVoice(index, note)
+	return index
+}
+
+// isTracked returns true if a voice plays a note that has not been released
+func (va *VoiceAllocator) isTracked(voice *synth.Voice) bool {
+	for _, v := range va.noteMap {
+		if v == voice {
+			return true
+		}
+	}
+	return false
+}
+
+// trackVoice records that the voice at index plays a note
+// A note already tracked on another voice is moved to this one.
+func (va *VoiceAllocator) trackVoice(index, note int) {
+	if _, exists := va.noteMap[note]; exists {
+		va.removeActiveNote(note)
+	}
+	va.noteMap[note] = va.voices[index]
 	va.activeNotes = append(va.activeNotes, note)
 }
 
+// untrackVoice forgets the note played by the voice at index, if any
+func (va *VoiceAllocator) untrackVoice(index int) {
+	for note, voice := range va.noteMap {
+		if voice == va.voices[index] {
+			delete(va.noteMap, note)
+			va.removeActiveNote(note)
+		}
+	}
+}
+
+// removeActiveNote removes a note from activeNotes
+func (va *VoiceAllocator) removeActiveNote(note int) {
+	for i, n := range va.activeNotes {
+		if n == note {
+			va.activeNotes = append(va.activeNotes[:i], va.activeNotes[i+1:]...)
+			break
+		}
+	}
+}
+
 // NoteOff releases a specific note
 func (va *VoiceAllocator) NoteOff(note int) {
 	if voice, exists := va.noteMap[note]; exists {
 		voice.NoteOff()
 		delete(va.noteMap, note)
-		// Remove from activeNotes
-		for i, n := range va.activeNotes {
-			if n == note {
-				va.activeNotes = append(va.activeNotes[:i], va.activeNotes[i+1:]...)
-				break
-			}
-		}
+		va.removeActiveNote(note)
 	}
 }
 
@@ -124,23 +267,18 @@ func (va *VoiceAllocator) AllNotesOff() {
 	va.activeNotes = va.activeNotes[:0] // Clear slice
 }
 
-// Next generates the next sample by mixing all active voices
+// Next generates the next sample by summing all active voices
+// The sum is not normalized, so a voice keeps its level when others stop;
+// headroom is left to the Mixer
 func (va *VoiceAllocator) Next() float64 {
 	var sample float64
-	activeCount := 0
-	
+
 	for _, voice := range va.voices {
 		if voice.IsActive() {
 			sample += voice.Next()
-			activeCount++
 		}
 	}
-	
-	// Normalize by number of active voices to prevent clipping
-	if activeCount > 0 {
-		sample /= float64(activeCount)
-	}
-	
+
 	return sample
 }
 
@@ -167,6 +305,16 @@ func (va *VoiceAllocator) GetVoice(index int) *synth.Voice {
 	return nil
 }
 
+// voiceIndex returns the slot of a voice owned by this allocator
+func (va *VoiceAllocator) voiceIndex(voice *synth.Voice) int {
+	for i, v := range va.voices {
+		if v == voice {
+			return i
+		}
+	}
+	return 0
+}
+
 // GetActiveNotes returns a list of currently active note numbers
 func (va *VoiceAllocator) GetActiveNotes() []int {
 	// Return a copy to prevent external modification
@@ -186,10 +334,13 @@ func (va *VoiceAllocator) GetVoiceForNote(note int) *synth.Voice {
 }
 
 // SetVoiceNote directly controls a specific voice (bypass allocation)
-// Useful for advanced control over harmonies
+// Useful for advanced control over harmonies. The note is tracked like one
+// started by NoteOn, so NoteOff and voice stealing see it.
 func (va *VoiceAllocator) SetVoiceNote(voiceIndex int, note int, velocity float64) {
 	if voiceIndex >= 0 && voiceIndex < len(va.voices) {
-		va.voices[voiceIndex].NoteOn(note, velocity)
+		va.untrackVoice(voiceIndex)
+		va.prepareVoice(voiceIndex).NoteOn(note, velocity)
+		va.trackVoice(voiceIndex, note)
 	}
 }
 
@@ -197,6 +348,7 @@ func (va *VoiceAllocator) SetVoiceNote(voiceIndex int, note int, velocity float6
 func (va *VoiceAllocator) ReleaseVoice(voiceIndex int) {
 	if voiceIndex >= 0 && voiceIndex < len(va.voices) {
 		va.voices[voiceIndex].NoteOff()
+		va.untrackVoice(voiceIndex)
 	}
 }
 
@@ -218,4 +370,3 @@ func (va *VoiceAllocator) ReleaseChord(notes []int) {
 		va.NoteOff(note)
 	}
 }
-
@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cjbrigato/go-vtm/synth"
+	"github.com/cjbrigato/go-vtm/tracker"
+)
+
+// loadModule parses a VTM module for a test
+func loadModule(t *testing.T, src string) *tracker.TrackerModule {
+	t.Helper()
+	module, err := tracker.ParseVTM(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseVTM: %v", err)
+	}
+	return module
+}
+
+func TestPatternVoiceSteal(t *testing.T) {
+	module := loadModule(t, `TEMPO 120
+INSTRUMENT Lead SQUARE 0.01 0.1 0.6 0.2
+PATTERN 2 1
+CH 0: [C-5+C-4+C-3] ...
+ENDPATTERN
+SEQUENCE 0
+`)
+	c5, c4, c3 := synth.ParseNote("C-5"), synth.ParseNote("C-4"), synth.ParseNote("C-3")
+
+	tests := []struct {
+		name   string
+		policy VoiceStealPolicy
+		want   []int
+	}{
+		{"oldest", StealOldest, []int{c4, c3}},
+		{"lowest", StealLowest, []int{c5, c3}},
+		{"none", StealNone, []int{c5, c4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewPlayerWithOptions(module, 44100, PlayerOptions{VoicesPerChannel: 2, VoiceSteal: tt.policy})
+			player.Next()
+
+			allocator := player.GetChannelVoices(0)
+			if got := allocator.GetActiveNotes(); !slices.Equal(got, tt.want) {
+				t.Errorf("active notes = %v, want %v", got, tt.want)
+			}
+			if got := allocator.GetActiveVoiceCount(); got != 2 {
+				t.Errorf("active voice count = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestVoiceAllocatorStealLowest(t *testing.T) {
+	inst := &tracker.Instrument{Name: "Lead", Attack: 0.01, Decay: 0.1, Sustain: 0.6, Release: 0.2}
+	allocator := NewVoiceAllocator(inst, 44100, 2)
+	allocator.SetStealPolicy(StealLowest)
+
+	allocator.NoteOn(60, 1.0)
+	allocator.NoteOn(48, 1.0)
+	allocator.NoteOn(72, 1.0)
+	if got, want := allocator.GetActiveNotes(), []int{60, 72}; !slices.Equal(got, want) {
+		t.Errorf("active notes = %v, want %v", got, want)
+	}
+
+	allocator.NoteOff(60)
+	if got, want := allocator.GetActiveNotes(), []int{72}; !slices.Equal(got, want) {
+		t.Errorf("active notes after NoteOff = %v, want %v", got, want)
+	}
+}
+
+func TestPatternVoicesAfterReset(t *testing.T) {
+	module := loadModule(t, `TEMPO 120
+INSTRUMENT Pad SINE 0.01 0.1 0.6 2.0
+PATTERN 2 1
+CH 0: [C-4+E-4+G-4] [C-4+E-4+G-4]
+ENDPATTERN
+SEQUENCE 0
+`)
+	player := NewPlayerWithOptions(module, 44100, PlayerOptions{VoicesPerChannel: 3})
+	player.Next()
+	player.Reset()
+	player.Next()
+
+	// The voices released by Reset are reused instead of stacking the chord on one
+	if got := player.GetChannelVoices(0).GetActiveVoiceCount(); got != 3 {
+		t.Errorf("active voice count after Reset = %d, want 3", got)
+	}
+}
+
+func TestVoiceNoiseIsIndependent(t *testing.T) {
+	inst := &tracker.Instrument{Name: "Snare", WaveType: synth.Noise, Attack: 0.001, Decay: 0.1, Sustain: 1.0, Release: 0.1}
+	channels := []*VoiceAllocator{NewVoiceAllocator(inst, 44100, 2), NewVoiceAllocator(inst, 44100, 2)}
+	for ch, allocator := range channels {
+		allocator.SetSeed(synth.DefaultNoiseSeed + uint64(ch)<<16)
+		allocator.SetVoiceNote(0, 48, 1.0)
+		allocator.SetVoiceNote(1, 48, 1.0)
+	}
+	voices := []*synth.Voice{channels[0].GetVoice(0), channels[0].GetVoice(1), channels[1].GetVoice(0)}
+
+	same := make([]int, len(voices))
+	for range 1000 {
+		first := voices[0].Next()
+		for i, voice := range voices[1:] {
+			if voice.Next() == first {
+				same[i+1]++
+			}
+		}
+	}
+	for i, n := range same[1:] {
+		if n > 10 {
+			t.Errorf("voice %d matches voice 0 on %d of 1000 samples", i+1, n)
+		}
+	}
+}
+
+func TestPlayerSizeLimits(t *testing.T) {
+	// A module built in code is held to the parser's limits too
+	chord := make([]int, 1000)
+	module := &tracker.TrackerModule{
+		Tempo:    120,
+		Channels: 1 << 20,
+		Patterns: []tracker.Pattern{{Rows: 1, Channels: [][]tracker.TrackerNote{{{Note: 60, Volume: 1.0, Chord: chord}}}}},
+		Sequence: []int{0},
+	}
+	player := NewPlayer(module, 44100)
+	if got := len(player.VoiceAllocators); got != tracker.MaxChannels {
+		t.Errorf("%d channels, want %d", got, tracker.MaxChannels)
+	}
+	if got := player.GetMaxPolyphony(); got != tracker.MaxVoices {
+		t.Errorf("%d voices per channel, want %d", got, tracker.MaxVoices)
+	}
+
+	module.Polyphony = 1 << 20
+	if got := NewPlayer(module, 44100).GetMaxPolyphony(); got != tracker.MaxVoices {
+		t.Errorf("POLYPHONY %d gives %d voices per channel, want %d", module.Polyphony, got, tracker.MaxVoices)
+	}
+}
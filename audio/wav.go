@@ -1,179 +1,217 @@
 package audio
 
 import (
+	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
 
 	"github.com/cjbrigato/go-vtm/tracker"
 )
 
+// WAVOptions configures a WAVWriter
+type WAVOptions struct {
+	SampleRate   int
+	Channels     int          // 1 (mono) or 2 (stereo, the default)
+	Format       SampleFormat // SampleS16 by default
+	NoDither     bool         // Round integer formats without TPDF dither
+	NoiseShaping bool         // Move the quantization noise to high frequencies
+
+	// Frames is the number of frames that will be written, which lets a
+	// writer that cannot seek write the final header up front. Without it
+	// such a writer marks the sizes as unknown, as streaming tools do.
+	Frames int
+}
+
+// wavHeaderSize is the size of the RIFF, fmt and data chunk headers
+const wavHeaderSize = 44
+
 // WAVWriter handles writing audio samples to a WAV file
+// Output is buffered; the header sizes are fixed on Close when the
+// destination can seek.
 type WAVWriter struct {
-	file       *os.File
-	sampleRate int
-	numSamples int
+	out     *bufio.Writer
+	seeker  io.WriteSeeker // nil when the header cannot be fixed on Close
+	closer  io.Closer      // File opened by NewWAVWriter
+	start   int64          // Offset of the header in seeker
+	opts    WAVOptions
+	encoder *sampleEncoder
+	size    int    // Bytes of sample data written
+	frame   []byte // Reused encoding buffer
 }
 
-// NewWAVWriter creates a new WAV file writer
+// NewWAVWriter creates a 16-bit stereo WAV file
 func NewWAVWriter(filename string, sampleRate int) (*WAVWriter, error) {
 	file, err := os.Create(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WAVWriter{
-		file:       file,
-		sampleRate: sampleRate,
-		numSamples: 0,
-	}, nil
+	w, err := NewWAVWriterTo(file, WAVOptions{SampleRate: sampleRate})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
 }
 
-// WriteHeader writes the WAV file header
-func (w *WAVWriter) writeHeader() error {
-	// RIFF header
-	if err := binary.Write(w.file, binary.LittleEndian, []byte("RIFF")); err != nil {
-		return err
+// NewWAVWriterTo starts a WAV file on w, writing its header
+// If w is an io.WriteSeeker that can seek, the header is fixed on Close;
+// otherwise it is written from opts.Frames. Close does not close w.
+func NewWAVWriterTo(w io.Writer, opts WAVOptions) (*WAVWriter, error) {
+	if opts.Channels == 0 {
+		opts.Channels = 2
 	}
-
-	// File size (placeholder, will be updated later)
-	fileSize := uint32(36 + w.numSamples*2*2) // 2 channels, 2 bytes per sample
-	if err := binary.Write(w.file, binary.LittleEndian, fileSize); err != nil {
-		return err
-	}
-
-	// WAVE header
-	if err := binary.Write(w.file, binary.LittleEndian, []byte("WAVE")); err != nil {
-		return err
+	if err := checkLayout(opts.Channels, opts.Format); err != nil {
+		return nil, err
 	}
-
-	// fmt chunk
-	if err := binary.Write(w.file, binary.LittleEndian, []byte("fmt ")); err != nil {
-		return err
+	if opts.SampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", opts.SampleRate)
 	}
 
-	// fmt chunk size (16 for PCM)
-	if err := binary.Write(w.file, binary.LittleEndian, uint32(16)); err != nil {
-		return err
+	writer := &WAVWriter{
+		out:     bufio.NewWriterSize(w, 64*1024),
+		opts:    opts,
+		encoder: newSampleEncoder(opts.Format, !opts.NoDither, opts.NoiseShaping),
 	}
 
-	// Audio format (1 = PCM)
-	if err := binary.Write(w.file, binary.LittleEndian, uint16(1)); err != nil {
-		return err
+	// Pipes are files too, but seeking them fails
+	if seeker, ok := w.(io.WriteSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			writer.seeker, writer.start = seeker, start
+		}
 	}
 
-	// Number of channels (2 = stereo)
-	if err := binary.Write(w.file, binary.LittleEndian, uint16(2)); err != nil {
-		return err
+	frames := -1 // Unknown
+	if writer.seeker == nil && opts.Frames > 0 {
+		frames = opts.Frames
 	}
-
-	// Sample rate
-	if err := binary.Write(w.file, binary.LittleEndian, uint32(w.sampleRate)); err != nil {
-		return err
+	if _, err := writer.out.Write(writer.header(frames)); err != nil {
+		return nil, err
 	}
+	return writer, nil
+}
 
-	// Byte rate (sample rate * channels * bytes per sample)
-	byteRate := uint32(w.sampleRate * 2 * 2)
-	if err := binary.Write(w.file, binary.LittleEndian, byteRate); err != nil {
-		return err
-	}
+// header returns the WAV header for a number of frames (-1 if unknown)
+func (w *WAVWriter) header(frames int) []byte {
+	blockAlign := w.blockAlign()
+	dataSize, riffSize := uint32(0xFFFFFFFF), uint32(0xFFFFFFFF)
+	if frames >= 0 {
+		dataSize = uint32(frames * blockAlign)
+		riffSize = wavHeaderSize - 8 + dataSize + dataSize%2
+	}
+	tag := uint16(1) // PCM
+	if w.opts.Format.IsFloat() {
+		tag = 3 // IEEE float
+	}
+
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, riffSize)
+	h = append(h, "WAVE"...)
+	h = append(h, "fmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, tag)
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.opts.Channels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.opts.SampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.opts.SampleRate*blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.opts.Format.BytesPerSample()*8))
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	return h
+}
 
-	// Block align (channels * bytes per sample)
-	if err := binary.Write(w.file, binary.LittleEndian, uint16(4)); err != nil {
-		return err
-	}
+// WriteSample writes a single stereo sample to the WAV file (expects sample in range -1.0 to 1.0)
+// Mono files get both channels mixed as by Player.Next and the Renderer.
+func (w *WAVWriter) WriteSample(left, right float64) error {
+	w.frame = w.frame[:0]
+	if w.opts.Channels == 1 {
+		w.frame = w.encoder.appendSample(w.frame, downmix(left, right), 0)
+	} else {
+		w.frame = w.encoder.appendSample(w.frame, left, 0)
+		w.frame = w.encoder.appendSample(w.frame, right, 1)
+	}
+	_, err := w.Write(w.frame)
+	return err
+}
 
-	// Bits per sample
-	if err := binary.Write(w.file, binary.LittleEndian, uint16(16)); err != nil {
-		return err
-	}
+// Write writes samples that are already encoded in the writer's format,
+// such as the output of a Renderer with the same format and channels
+func (w *WAVWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	w.size += n
+	return n, err
+}
 
-	// data chunk
-	if err := binary.Write(w.file, binary.LittleEndian, []byte("data")); err != nil {
-		return err
-	}
+// blockAlign returns the size of one frame
+func (w *WAVWriter) blockAlign() int {
+	return w.opts.Channels * w.opts.Format.BytesPerSample()
+}
 
-	// data chunk size
-	dataSize := uint32(w.numSamples * 2 * 2) // 2 channels, 2 bytes per sample
-	if err := binary.Write(w.file, binary.LittleEndian, dataSize); err != nil {
-		return err
+// Close finalizes the WAV file, and closes it if NewWAVWriter created it
+func (w *WAVWriter) Close() error {
+	err := w.finish()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
 	}
-
-	return nil
+	return err
 }
 
-// WriteSample writes a single stereo sample to the WAV file (expects sample in range -1.0 to 1.0)
-func (w *WAVWriter) WriteSample(left, right float64) error {
-	// Convert float64 [-1.0, 1.0] to int16
-	leftSample := int16(left * 32767.0)
-	rightSample := int16(right * 32767.0)
-
-	if err := binary.Write(w.file, binary.LittleEndian, leftSample); err != nil {
-		return err
+// finish pads the data chunk and fixes the header sizes
+func (w *WAVWriter) finish() error {
+	// Chunks have an even size
+	if w.size%2 == 1 {
+		if err := w.out.WriteByte(0); err != nil {
+			return err
+		}
 	}
-
-	if err := binary.Write(w.file, binary.LittleEndian, rightSample); err != nil {
+	if err := w.out.Flush(); err != nil {
 		return err
 	}
 
-	w.numSamples++
-	return nil
-}
-
-// Close finalizes and closes the WAV file
-func (w *WAVWriter) Close() error {
-	// Update file size in header
-	if _, err := w.file.Seek(4, io.SeekStart); err != nil {
-		return err
+	if w.seeker == nil {
+		if frames := w.size / w.blockAlign(); w.opts.Frames > 0 && frames != w.opts.Frames {
+			return fmt.Errorf("wrote %d frames but the header says %d", frames, w.opts.Frames)
+		}
+		return nil
 	}
-	fileSize := uint32(36 + w.numSamples*2*2)
-	if err := binary.Write(w.file, binary.LittleEndian, fileSize); err != nil {
+
+	end, err := w.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
 		return err
 	}
-
-	// Update data chunk size
-	if _, err := w.file.Seek(40, io.SeekStart); err != nil {
+	if _, err := w.seeker.Seek(w.start, io.SeekStart); err != nil {
 		return err
 	}
-	dataSize := uint32(w.numSamples * 2 * 2)
-	if err := binary.Write(w.file, binary.LittleEndian, dataSize); err != nil {
+	if _, err := w.seeker.Write(w.header(w.size / w.blockAlign())); err != nil {
 		return err
 	}
-
-	return w.file.Close()
+	_, err = w.seeker.Seek(end, io.SeekStart)
+	return err
 }
 
-// RenderToWAV renders an entire tracker module to a WAV file
+// RenderToWAV renders an entire tracker module to a 16-bit stereo WAV file
 func RenderToWAV(module *tracker.TrackerModule, sampleRate int, filename string) error {
-	// Create player
-	player := NewPlayer(module, float64(sampleRate))
+	renderer, err := NewRenderer(NewPlayer(module, float64(sampleRate)), RendererOptions{})
+	if err != nil {
+		return err
+	}
 
-	// Create WAV writer with temporary header
 	wavWriter, err := NewWAVWriter(filename, sampleRate)
 	if err != nil {
 		return fmt.Errorf("failed to create WAV file: %v", err)
 	}
 
-	// Write placeholder header (will be updated at the end)
-	if err := wavWriter.writeHeader(); err != nil {
-		wavWriter.file.Close()
-		return fmt.Errorf("failed to write WAV header: %v", err)
-	}
-
-	// Generate and write samples
-	for !player.IsDone() {
-		sample := player.Next()
-		
-		// Clamp sample to prevent clipping
-		sample = math.Max(-1.0, math.Min(1.0, sample))
-		
-		// Write stereo (same sample for both channels for now)
-		if err := wavWriter.WriteSample(sample, sample); err != nil {
-			wavWriter.file.Close()
-			return fmt.Errorf("failed to write sample: %v", err)
-		}
+	// The player's limiter keeps peaks under its ceiling and the renderer
+	// clips anything beyond full scale
+	if _, err := io.Copy(wavWriter, renderer); err != nil {
+		return errors.Join(fmt.Errorf("failed to write samples: %v", err), wavWriter.Close())
 	}
 
 	// Close and finalize
@@ -183,4 +221,3 @@ func RenderToWAV(module *tracker.TrackerModule, sampleRate int, filename string)
 
 	return nil
 }
-
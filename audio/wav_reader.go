@@ -0,0 +1,32 @@
+package audio
+
+import (
+	"io"
+
+	"github.com/cjbrigato/go-vtm/internal/wav"
+)
+
+// WAVData is audio decoded by ReadWAV
+// Frames returns the number of samples in each channel, and UnityNote the
+// MIDI note the audio was recorded at (-1 if unknown).
+type WAVData = wav.File
+
+// WAVLoop is a loop stored in the smpl chunk of a WAV file, from its first
+// frame to the frame after its end
+type WAVLoop = wav.Loop
+
+// WAVLoopType is how a WAVLoop is played
+type WAVLoopType = wav.LoopType
+
+const (
+	WAVLoopForward     = wav.LoopForward
+	WAVLoopAlternating = wav.LoopAlternating // Ping-pong
+	WAVLoopBackward    = wav.LoopBackward
+)
+
+// ReadWAV decodes a WAV file holding 8, 16, 24 or 32-bit PCM or 32 or 64-bit
+// float samples, with any number of channels, in the plain or
+// WAVE_FORMAT_EXTENSIBLE layout. Samples are normalized to -1.0..1.0.
+func ReadWAV(r io.Reader) (*WAVData, error) {
+	return wav.Decode(r)
+}
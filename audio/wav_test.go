@@ -0,0 +1,208 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSignal returns a stereo test frame
+func testSignal(i int) (left, right float64) {
+	return 0.8 * math.Sin(float64(i)*0.05), 0.5 * math.Cos(float64(i)*0.031)
+}
+
+func TestWAVWriterFormats(t *testing.T) {
+	const frames = 1000
+
+	tests := []struct {
+		name     string
+		opts     WAVOptions
+		maxError float64 // Largest difference from the input allowed
+	}{
+		// Integer formats are off by up to 1.5 steps with dither, and
+		// decoding divides by a power of two where encoding multiplies by
+		// one less
+		{"s16 stereo", WAVOptions{Format: SampleS16}, 3.0 / (1 << 15)},
+		{"s24 stereo", WAVOptions{Format: SampleS24}, 3.0 / (1 << 23)},
+		{"s32 stereo", WAVOptions{Format: SampleS32}, 3.0 / (1 << 31)},
+		{"f32 stereo", WAVOptions{Format: SampleF32}, 1e-7},
+		{"s16 mono", WAVOptions{Channels: 1, Format: SampleS16}, 3.0 / (1 << 15)},
+		{"f32 mono", WAVOptions{Channels: 1, Format: SampleF32}, 1e-7},
+		{"s16 without dither", WAVOptions{Format: SampleS16, NoDither: true}, 1.5 / (1 << 15)},
+		{"s16 noise shaped", WAVOptions{Format: SampleS16, NoiseShaping: true}, 5.0 / (1 << 15)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.SampleRate, opts.Frames = 48000, frames
+			var buf bytes.Buffer
+			w, err := NewWAVWriterTo(&buf, opts)
+			if err != nil {
+				t.Fatalf("NewWAVWriterTo: %v", err)
+			}
+			for i := range frames {
+				if err := w.WriteSample(testSignal(i)); err != nil {
+					t.Fatalf("WriteSample: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			data, err := ReadWAV(&buf)
+			if err != nil {
+				t.Fatalf("ReadWAV: %v", err)
+			}
+			channels := 2
+			if opts.Channels == 1 {
+				channels = 1
+			}
+			if data.SampleRate != 48000 || len(data.Channels) != channels || data.Frames() != frames {
+				t.Fatalf("got %d Hz, %d channels of %d frames", data.SampleRate, len(data.Channels), data.Frames())
+			}
+
+			for i := range frames {
+				left, right := testSignal(i)
+				want := []float64{left, right}
+				if channels == 1 {
+					want = []float64{downmix(left, right)}
+				}
+				for ch, w := range want {
+					if got := data.Channels[ch][i]; math.Abs(got-w) > tt.maxError {
+						t.Fatalf("channel %d frame %d = %.9f, want %.9f", ch, i, got, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWAVWriterDither(t *testing.T) {
+	// A constant between two 16-bit steps always rounds the same way
+	// without dither, and averages out to its real value with it
+	const frames = 20000
+	x := 100.3 / 32767.0
+
+	for _, noDither := range []bool{true, false} {
+		var buf bytes.Buffer
+		w, err := NewWAVWriterTo(&buf, WAVOptions{SampleRate: 44100, Channels: 1, NoDither: noDither, Frames: frames})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range frames {
+			// Mono mixes down at +3dB, so split the level between the sides
+			w.WriteSample(x/math.Sqrt2, x/math.Sqrt2)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		samples := make([]int16, frames)
+		binary.Read(bytes.NewReader(buf.Bytes()[wavHeaderSize:]), binary.LittleEndian, samples)
+		var sum float64
+		distinct := map[int16]bool{}
+		for _, s := range samples {
+			sum += float64(s)
+			distinct[s] = true
+		}
+		mean := sum / frames
+
+		if noDither {
+			if len(distinct) != 1 || !distinct[100] {
+				t.Errorf("without dither got values %v, want only 100", distinct)
+			}
+		} else if math.Abs(mean-100.3) > 0.05 || len(distinct) < 2 {
+			t.Errorf("with dither mean = %.3f over %d values, want 100.3", mean, len(distinct))
+		}
+	}
+}
+
+func TestWAVWriterHeaders(t *testing.T) {
+	// Seekable files get their sizes fixed on Close
+	name := filepath.Join(t.TempDir(), "out.wav")
+	w, err := NewWAVWriter(name, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 101 {
+		w.WriteSample(testSignal(i))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := ReadWAV(file)
+	if err != nil {
+		t.Fatalf("ReadWAV: %v", err)
+	}
+	if data.Frames() != 101 {
+		t.Errorf("seekable file has %d frames, want 101", data.Frames())
+	}
+
+	// Streams without a frame count mark the sizes unknown
+	var buf bytes.Buffer
+	w, err = NewWAVWriterTo(&buf, WAVOptions{SampleRate: 22050})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteSample(0.1, 0.1)
+	w.Close()
+	if size := binary.LittleEndian.Uint32(buf.Bytes()[40:44]); size != 0xFFFFFFFF {
+		t.Errorf("data size = %#x, want 0xFFFFFFFF", size)
+	}
+
+	// A stream writing fewer frames than announced reports it
+	w, err = NewWAVWriterTo(io.Discard, WAVOptions{SampleRate: 22050, Frames: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteSample(0.1, 0.1)
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded with 1 of 10 frames written")
+	}
+}
+
+func TestMonoLevelsMatch(t *testing.T) {
+	module := loadModule(t, `TEMPO 240
+INSTRUMENT Lead SINE 0.001 0.1 0.8 0.01
+PAN 0 -0.6
+PATTERN 2 1
+CH 0: C-4 ===
+ENDPATTERN
+SEQUENCE 0
+`)
+
+	// The same song as a mono stream and as a mono WAV file
+	renderer, err := NewRenderer(NewPlayer(module, 8000), RendererOptions{Channels: 1, Format: SampleF32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := io.ReadAll(renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWAVWriterTo(&buf, WAVOptions{SampleRate: 8000, Channels: 1, Format: SampleF32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewPlayer(module, 8000)
+	for !player.IsDone() {
+		w.WriteSample(player.NextStereo())
+	}
+	w.Close()
+
+	if !bytes.Equal(buf.Bytes()[wavHeaderSize:], streamed) {
+		t.Error("mono WAV samples differ from the mono Renderer stream")
+	}
+}
@@ -0,0 +1,245 @@
+// Package wav decodes RIFF WAVE files, for sample instruments
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format tags of the fmt chunk
+const (
+	formatPCM        = 0x0001
+	formatFloat      = 0x0003
+	formatExtensible = 0xFFFE // The real tag is the start of the SubFormat GUID
+)
+
+// LoopType is how a smpl chunk loop is played
+type LoopType int
+
+const (
+	LoopForward     LoopType = 0
+	LoopAlternating LoopType = 1 // Ping-pong
+	LoopBackward    LoopType = 2
+)
+
+// Loop is a sample loop from the smpl chunk
+type Loop struct {
+	Start int // First frame of the loop
+	End   int // Frame after the end of the loop
+	Type  LoopType
+}
+
+// File is a decoded WAV file
+type File struct {
+	SampleRate int
+	Channels   [][]float64 // Samples of each channel, from -1.0 to 1.0
+	Loops      []Loop      // Loops from the smpl chunk
+	UnityNote  int         // MIDI note the sample was recorded at (-1 if unknown)
+}
+
+// Frames returns the number of samples in each channel
+func (f *File) Frames() int {
+	if len(f.Channels) == 0 {
+		return 0
+	}
+	return len(f.Channels[0])
+}
+
+// format is the content of the fmt chunk
+type format struct {
+	tag           uint16
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16 // Size of each sample in the data chunk
+}
+
+// Decode reads a WAV file holding 8, 16, 24 or 32-bit PCM or 32 or 64-bit
+// float samples, in the plain or WAVE_FORMAT_EXTENSIBLE layout
+func Decode(r io.Reader) (*File, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("reading RIFF header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var fmtChunk *format
+	var data []byte
+	file := &File{UnityNote: -1}
+
+	// The smpl chunk often comes after the data, so read every chunk
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if data != nil && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				break // Trailing bytes after the last chunk are ignored
+			}
+			if err == io.EOF {
+				return nil, errors.New("no data chunk")
+			}
+			return nil, fmt.Errorf("reading chunk header: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			body, err := readChunk(r, size)
+			if err != nil {
+				return nil, fmt.Errorf("reading fmt chunk: %w", err)
+			}
+			if fmtChunk, err = parseFormat(body); err != nil {
+				return nil, err
+			}
+
+		case "data":
+			if fmtChunk == nil {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			// A truncated file keeps the frames that are complete
+			var err error
+			data, err = io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				return nil, fmt.Errorf("reading data chunk: %w", err)
+			}
+			if int64(len(data)) < size {
+				size = 0 // Nothing left to skip
+			}
+
+		case "smpl":
+			body, err := readChunk(r, size)
+			if err != nil {
+				return nil, fmt.Errorf("reading smpl chunk: %w", err)
+			}
+			parseSampler(body, file)
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil && data == nil {
+				return nil, fmt.Errorf("skipping %q chunk: %w", id, err)
+			}
+		}
+
+		// Chunks are padded to an even size
+		if size%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil && data == nil {
+				return nil, fmt.Errorf("skipping padding: %w", err)
+			}
+		}
+	}
+
+	if err := decodeData(data, fmtChunk, file); err != nil {
+		return nil, err
+	}
+
+	// Drop loops that do not fit the sample
+	loops := file.Loops[:0]
+	for _, loop := range file.Loops {
+		if loop.Start >= 0 && loop.End > loop.Start && loop.End <= file.Frames() {
+			loops = append(loops, loop)
+		}
+	}
+	file.Loops = loops
+	return file, nil
+}
+
+// maxChunkSize limits the size of the chunks read into memory besides the
+// data, so a corrupt size cannot make Decode allocate gigabytes
+const maxChunkSize = 64 << 10
+
+// readChunk reads a whole chunk body
+func readChunk(r io.Reader, size int64) ([]byte, error) {
+	if size > maxChunkSize {
+		return nil, fmt.Errorf("chunk of %d bytes is larger than %d", size, maxChunkSize)
+	}
+	body := make([]byte, size)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// parseFormat parses the fmt chunk
+func parseFormat(body []byte) (*format, error) {
+	if len(body) < 16 {
+		return nil, errors.New("fmt chunk too short")
+	}
+	f := &format{
+		tag:           binary.LittleEndian.Uint16(body[0:2]),
+		channels:      binary.LittleEndian.Uint16(body[2:4]),
+		sampleRate:    binary.LittleEndian.Uint32(body[4:8]),
+		bitsPerSample: binary.LittleEndian.Uint16(body[14:16]),
+	}
+	if f.tag == formatExtensible {
+		if len(body) < 26 {
+			return nil, errors.New("WAVE_FORMAT_EXTENSIBLE fmt chunk too short")
+		}
+		f.tag = binary.LittleEndian.Uint16(body[24:26])
+	}
+	if f.channels == 0 || f.sampleRate == 0 {
+		return nil, errors.New("no channels or no sample rate")
+	}
+	return f, nil
+}
+
+// parseSampler reads the MIDI unity note and the loops of a smpl chunk
+func parseSampler(body []byte, file *File) {
+	if len(body) < 36 {
+		return
+	}
+	file.UnityNote = int(binary.LittleEndian.Uint32(body[12:16]))
+	count := int(binary.LittleEndian.Uint32(body[28:32]))
+	for i := range count {
+		if 36+(i+1)*24 > len(body) {
+			break
+		}
+		loop := body[36+i*24:]
+		// The smpl end frame is the last frame played
+		file.Loops = append(file.Loops, Loop{
+			Type:  LoopType(binary.LittleEndian.Uint32(loop[4:8])),
+			Start: int(binary.LittleEndian.Uint32(loop[8:12])),
+			End:   int(binary.LittleEndian.Uint32(loop[12:16])) + 1,
+		})
+	}
+}
+
+// decodeData converts the samples of the data chunk
+func decodeData(data []byte, f *format, file *File) error {
+	var decode func(b []byte) float64
+	switch {
+	case f.tag == formatPCM && f.bitsPerSample == 8:
+		decode = func(b []byte) float64 { return (float64(b[0]) - 128.0) / 128.0 }
+	case f.tag == formatPCM && f.bitsPerSample == 16:
+		decode = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case f.tag == formatPCM && f.bitsPerSample == 24:
+		decode = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)) / (1 << 31)
+		}
+	case f.tag == formatPCM && f.bitsPerSample == 32:
+		decode = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case f.tag == formatFloat && f.bitsPerSample == 32:
+		decode = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case f.tag == formatFloat && f.bitsPerSample == 64:
+		decode = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return fmt.Errorf("unsupported format %d with %d bits per sample", f.tag, f.bitsPerSample)
+	}
+
+	bytesPerSample := int(f.bitsPerSample / 8)
+	frameSize := bytesPerSample * int(f.channels)
+	frames := len(data) / frameSize
+
+	file.SampleRate = int(f.sampleRate)
+	file.Channels = make([][]float64, f.channels)
+	for ch := range file.Channels {
+		file.Channels[ch] = make([]float64, frames)
+	}
+	for i := range frames {
+		frame := data[i*frameSize:]
+		for ch := range file.Channels {
+			file.Channels[ch][i] = decode(frame[ch*bytesPerSample:])
+		}
+	}
+	return nil
+}
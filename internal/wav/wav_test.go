@@ -0,0 +1,186 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// chunk encodes a RIFF chunk, padded to an even size
+func chunk(id string, body []byte) []byte {
+	b := []byte(id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fmtBody encodes a fmt chunk, in the WAVE_FORMAT_EXTENSIBLE layout if asked
+func fmtBody(tag uint16, channels, bits int, extensible bool) []byte {
+	blockAlign := channels * bits / 8
+	headerTag := tag
+	if extensible {
+		headerTag = formatExtensible
+	}
+	b := binary.LittleEndian.AppendUint16(nil, headerTag)
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels))
+	b = binary.LittleEndian.AppendUint32(b, 44100)
+	b = binary.LittleEndian.AppendUint32(b, uint32(44100*blockAlign))
+	b = binary.LittleEndian.AppendUint16(b, uint16(blockAlign))
+	b = binary.LittleEndian.AppendUint16(b, uint16(bits))
+	if extensible {
+		b = binary.LittleEndian.AppendUint16(b, 22)
+		b = binary.LittleEndian.AppendUint16(b, uint16(bits))
+		b = binary.LittleEndian.AppendUint32(b, 0) // Channel mask
+		b = binary.LittleEndian.AppendUint16(b, tag)
+		b = append(b, "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71"...)
+	}
+	return b
+}
+
+// riff wraps chunks in a RIFF WAVE header
+func riff(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return chunk("RIFF", body)
+}
+
+func TestDecodeFormats(t *testing.T) {
+	// Every format encodes these frames of a stereo file
+	want := [][]float64{{0.0, 0.5, -0.5, -1.0}, {0.25, -0.25, 0.75, 0.0}}
+
+	tests := []struct {
+		name       string
+		tag        uint16
+		bits       int
+		extensible bool
+		encode     func(v float64) []byte
+	}{
+		{"8-bit PCM", formatPCM, 8, false, func(v float64) []byte {
+			return []byte{byte(v*128.0 + 128.0)}
+		}},
+		{"16-bit PCM", formatPCM, 16, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint16(nil, uint16(int16(v*(1<<15))))
+		}},
+		{"24-bit PCM", formatPCM, 24, false, func(v float64) []byte {
+			x := uint32(int32(v * (1 << 23)))
+			return []byte{byte(x), byte(x >> 8), byte(x >> 16)}
+		}},
+		{"32-bit PCM", formatPCM, 32, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, uint32(int32(v*(1<<31))))
+		}},
+		{"32-bit float", formatFloat, 32, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v)))
+		}},
+		{"64-bit float", formatFloat, 64, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+		}},
+		{"extensible 24-bit PCM", formatPCM, 24, true, func(v float64) []byte {
+			x := uint32(int32(v * (1 << 23)))
+			return []byte{byte(x), byte(x >> 8), byte(x >> 16)}
+		}},
+		{"extensible 32-bit float", formatFloat, 32, true, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v)))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []byte
+			for i := range want[0] {
+				for ch := range want {
+					data = append(data, tt.encode(want[ch][i])...)
+				}
+			}
+			src := riff(chunk("fmt ", fmtBody(tt.tag, 2, tt.bits, tt.extensible)), chunk("data", data))
+
+			file, err := Decode(bytes.NewReader(src))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if file.SampleRate != 44100 || len(file.Channels) != 2 || file.Frames() != len(want[0]) {
+				t.Fatalf("got %d Hz, %d channels of %d frames", file.SampleRate, len(file.Channels), file.Frames())
+			}
+			for ch := range want {
+				for i, w := range want[ch] {
+					if got := file.Channels[ch][i]; math.Abs(got-w) > 1.0/128.0 {
+						t.Errorf("channel %d frame %d = %f, want %f", ch, i, got, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeSampler(t *testing.T) {
+	smpl := make([]byte, 36)
+	binary.LittleEndian.PutUint32(smpl[12:], 62) // D-4
+	binary.LittleEndian.PutUint32(smpl[28:], 3)  // Loop count
+	for _, loop := range [][3]uint32{{1, 2, 5}, {0, 0, 99}, {2, 8, 3}} {
+		l := make([]byte, 24)
+		binary.LittleEndian.PutUint32(l[4:], loop[0])
+		binary.LittleEndian.PutUint32(l[8:], loop[1])
+		binary.LittleEndian.PutUint32(l[12:], loop[2])
+		smpl = append(smpl, l...)
+	}
+
+	// The smpl chunk after an odd-sized data chunk, as many editors write it
+	data := make([]byte, 9)
+	src := riff(chunk("fmt ", fmtBody(formatPCM, 1, 8, false)), chunk("data", data), chunk("smpl", smpl))
+
+	file, err := Decode(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if file.UnityNote != 62 {
+		t.Errorf("UnityNote = %d, want 62", file.UnityNote)
+	}
+	// The loop past the end of the 9 frames and the reversed one are dropped
+	if len(file.Loops) != 1 || file.Loops[0] != (Loop{Start: 2, End: 6, Type: LoopAlternating}) {
+		t.Errorf("Loops = %+v, want one ping-pong loop from 2 to 6", file.Loops)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	fmtChunk := chunk("fmt ", fmtBody(formatPCM, 1, 16, false))
+
+	// A smpl chunk claiming to hold 1 billion loops
+	smpl := make([]byte, 36)
+	binary.LittleEndian.PutUint32(smpl[28:], 1<<30)
+
+	huge := []byte("fmt ")
+	huge = binary.LittleEndian.AppendUint32(huge, 0xFFFFFFF0)
+
+	tests := []struct {
+		name    string
+		src     []byte
+		wantErr string // "" if the file decodes
+	}{
+		{"not a WAV file", []byte("RIFF\x04\x00\x00\x00AVI "), "not a WAV file"},
+		{"empty", nil, "reading RIFF header"},
+		{"no data chunk", riff(fmtChunk), "no data chunk"},
+		{"data before fmt", riff(chunk("data", []byte{0, 0}), fmtChunk), "data chunk before fmt chunk"},
+		{"huge fmt chunk", riff(huge), "larger than"},
+		{"unsupported format", riff(chunk("fmt ", fmtBody(2, 1, 4, false)), chunk("data", []byte{0})), "unsupported format"},
+		{"too many loops", riff(fmtChunk, chunk("data", []byte{0, 0}), chunk("smpl", smpl)), ""},
+		{"truncated data", riff(fmtChunk, chunk("data", []byte{1, 2, 3, 4, 5, 6}))[:8+4+len(fmtChunk)+8+3], ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.src))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Decode: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Decode error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
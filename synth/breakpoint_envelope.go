@@ -0,0 +1,88 @@
+package synth
+
+// Breakpoint is a point of a BreakpointEnvelope
+type Breakpoint struct {
+	Tick  int // Ticks since the note started
+	Value float64
+}
+
+// BreakpointEnvelope is a multi-segment envelope in the style of XM/IT
+// instruments: values are interpolated linearly between points, the
+// envelope can stop at a sustain point while the note is held, and it can
+// loop between two ticks
+type BreakpointEnvelope struct {
+	Points    []Breakpoint // In increasing tick order
+	Sustain   int          // Tick held while the note is held (-1 for none)
+	LoopStart int          // Tick the loop jumps back to (-1 for no loop)
+	LoopEnd   int          // Tick at which the loop jumps back
+}
+
+// NewBreakpointEnvelope creates an envelope through the given points,
+// without sustain or loop
+func NewBreakpointEnvelope(points ...Breakpoint) *BreakpointEnvelope {
+	return &BreakpointEnvelope{
+		Points:    points,
+		Sustain:   -1,
+		LoopStart: -1,
+		LoopEnd:   -1,
+	}
+}
+
+// HasLoop returns true if the envelope loops
+func (e *BreakpointEnvelope) HasLoop() bool {
+	return e.LoopStart >= 0 && e.LoopEnd > e.LoopStart
+}
+
+// ValueAt returns the envelope value at a tick, holding the first and last
+// values outside the points
+func (e *BreakpointEnvelope) ValueAt(tick int) float64 {
+	if len(e.Points) == 0 {
+		return 0.0
+	}
+	if tick <= e.Points[0].Tick {
+		return e.Points[0].Value
+	}
+	for i := 1; i < len(e.Points); i++ {
+		a, b := e.Points[i-1], e.Points[i]
+		if tick < b.Tick {
+			t := float64(tick-a.Tick) / float64(b.Tick-a.Tick)
+			return a.Value + t*(b.Value-a.Value)
+		}
+	}
+	return e.Points[len(e.Points)-1].Value
+}
+
+// Playhead starts following the envelope for a new note
+func (e *BreakpointEnvelope) Playhead() *BreakpointPlayhead {
+	return &BreakpointPlayhead{envelope: e}
+}
+
+// BreakpointPlayhead is the position of one note in a BreakpointEnvelope
+type BreakpointPlayhead struct {
+	envelope *BreakpointEnvelope
+	tick     int
+	released bool
+}
+
+// Value returns the envelope value at the current tick
+func (p *BreakpointPlayhead) Value() float64 {
+	return p.envelope.ValueAt(p.tick)
+}
+
+// Advance moves to the next tick, stopping at the sustain point until the
+// note is released and jumping back at the end of the loop
+func (p *BreakpointPlayhead) Advance() {
+	e := p.envelope
+	if !p.released && p.tick == e.Sustain {
+		return
+	}
+	p.tick++
+	if e.HasLoop() && p.tick >= e.LoopEnd {
+		p.tick = e.LoopStart
+	}
+}
+
+// Release lets the envelope move past its sustain point
+func (p *BreakpointPlayhead) Release() {
+	p.released = true
+}
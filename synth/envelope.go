@@ -1,5 +1,7 @@
 package synth
 
+import "math"
+
 // EnvelopeStage represents the current stage of the envelope
 type EnvelopeStage int
 
@@ -9,17 +11,36 @@ const (
 	Sustain
 	Release
 	Off
+	Delay // Waiting before the attack (DAHDSR)
+	Hold  // Holding full level between attack and decay (DAHDSR)
+)
+
+// EnvelopeCurve shapes the attack, decay and release segments
+// 0 is linear; positive values move quickly at first and slow down towards
+// the target like an analog envelope, negative values do the opposite
+type EnvelopeCurve float64
+
+const (
+	CurveLinear      EnvelopeCurve = 0.0
+	CurveExponential EnvelopeCurve = 5.0
 )
 
-// Envelope implements ADSR envelope generator
+// Envelope implements a DAHDSR envelope generator
+// Every segment starts from the current level, so releasing early or
+// retriggering a sounding note never jumps
 type Envelope struct {
-	attackTime  float64 // seconds
-	decayTime   float64 // seconds
+	delayTime    float64 // seconds
+	attackTime   float64 // seconds
+	holdTime     float64 // seconds
+	decayTime    float64 // seconds
 	sustainLevel float64 // 0.0 to 1.0
-	releaseTime float64 // seconds
+	releaseTime  float64 // seconds
+	curve        EnvelopeCurve
+	legato       bool // Retriggering a held note does not restart the envelope
 
 	stage       EnvelopeStage
 	level       float64
+	startLevel  float64 // Level at the start of the current segment
 	sampleRate  float64
 	sampleCount int
 }
@@ -37,68 +58,125 @@ func NewEnvelope(attack, decay, sustain, release, sampleRate float64) *Envelope
 	}
 }
 
-// Trigger starts the envelope from attack stage
+// SetADSR changes the attack, decay, sustain and release settings,
+// keeping the other settings and the current state
+func (e *Envelope) SetADSR(attack, decay, sustain, release float64) {
+	e.attackTime = attack
+	e.decayTime = decay
+	e.sustainLevel = sustain
+	e.releaseTime = release
+}
+
+// SetDelay sets the time in seconds before the attack starts
+func (e *Envelope) SetDelay(seconds float64) {
+	e.delayTime = seconds
+}
+
+// SetHold sets the time in seconds full level is held after the attack
+func (e *Envelope) SetHold(seconds float64) {
+	e.holdTime = seconds
+}
+
+// SetCurve sets the shape of the attack, decay and release segments
+func (e *Envelope) SetCurve(curve EnvelopeCurve) {
+	e.curve = curve
+}
+
+// SetLegato makes Trigger leave a held note's envelope running, so only
+// notes started after a release get a new attack
+func (e *Envelope) SetLegato(legato bool) {
+	e.legato = legato
+}
+
+// Trigger starts the envelope from the delay (or attack) stage
+// The attack rises from the current level, so retriggering does not click
 func (e *Envelope) Trigger() {
-	e.stage = Attack
-	e.sampleCount = 0
+	if e.legato && e.isHeld() {
+		return
+	}
+	e.enter(Delay)
+	if e.delayTime <= 0 {
+		e.enter(Attack)
+	}
 }
 
-// Release moves to release stage
+// Release moves to release stage, fading out from the current level
 func (e *Envelope) Release() {
 	if e.stage != Off {
-		e.stage = Release
-		e.sampleCount = 0
+		e.enter(Release)
 	}
 }
 
+// Reset stops the envelope immediately
+func (e *Envelope) Reset() {
+	e.stage = Off
+	e.level = 0.0
+}
+
+// GetLevel returns the current envelope level
+func (e *Envelope) GetLevel() float64 {
+	return e.level
+}
+
+// GetStage returns the current envelope stage
+func (e *Envelope) GetStage() EnvelopeStage {
+	return e.stage
+}
+
+// enter starts a stage from the current level
+func (e *Envelope) enter(stage EnvelopeStage) {
+	e.stage = stage
+	e.startLevel = e.level
+	e.sampleCount = 0
+}
+
+// segment advances a stage lasting seconds towards target, returning true
+// once it is complete
+func (e *Envelope) segment(seconds, target float64) bool {
+	samples := int(seconds * e.sampleRate)
+	if e.sampleCount >= samples {
+		e.level = target
+		return true
+	}
+	t := e.curve.shape(float64(e.sampleCount) / float64(samples))
+	e.level = e.startLevel + t*(target-e.startLevel)
+	e.sampleCount++
+	return false
+}
+
 // Next generates the next envelope sample
 func (e *Envelope) Next() float64 {
 	switch e.stage {
+	case Delay:
+		if e.sampleCount >= int(e.delayTime*e.sampleRate) {
+			e.enter(Attack)
+			return e.Next()
+		}
+		e.sampleCount++
+
 	case Attack:
-		attackSamples := int(e.attackTime * e.sampleRate)
-		if attackSamples == 0 {
-			e.level = 1.0
-			e.stage = Decay
-			e.sampleCount = 0
-		} else if e.sampleCount >= attackSamples {
-			e.level = 1.0
-			e.stage = Decay
-			e.sampleCount = 0
-		} else {
-			e.level = float64(e.sampleCount) / float64(attackSamples)
-			e.sampleCount++
+		if e.segment(e.attackTime, 1.0) {
+			e.enter(Hold)
 		}
 
+	case Hold:
+		if e.sampleCount >= int(e.holdTime*e.sampleRate) {
+			e.enter(Decay)
+			return e.Next()
+		}
+		e.sampleCount++
+
 	case Decay:
-		decaySamples := int(e.decayTime * e.sampleRate)
-		if decaySamples == 0 {
-			e.level = e.sustainLevel
-			e.stage = Sustain
-		} else if e.sampleCount >= decaySamples {
-			e.level = e.sustainLevel
-			e.stage = Sustain
-		} else {
-			t := float64(e.sampleCount) / float64(decaySamples)
-			e.level = 1.0 + t*(e.sustainLevel-1.0)
-			e.sampleCount++
+		if e.segment(e.decayTime, e.sustainLevel) {
+			e.enter(Sustain)
 		}
 
 	case Sustain:
 		e.level = e.sustainLevel
 
 	case Release:
-		releaseSamples := int(e.releaseTime * e.sampleRate)
-		startLevel := e.sustainLevel
-		if releaseSamples == 0 {
-			e.level = 0.0
-			e.stage = Off
-		} else if e.sampleCount >= releaseSamples {
-			e.level = 0.0
+		if e.segment(e.releaseTime, 0.0) {
 			e.stage = Off
-		} else {
-			t := float64(e.sampleCount) / float64(releaseSamples)
-			e.level = startLevel * (1.0 - t)
-			e.sampleCount++
 		}
 
 	case Off:
@@ -108,7 +186,21 @@ func (e *Envelope) Next() float64 {
 	return e.level
 }
 
+// isHeld returns true if the note has started and not been released
+func (e *Envelope) isHeld() bool {
+	return e.stage != Off && e.stage != Release
+}
+
 // IsActive returns true if envelope is not in Off stage
 func (e *Envelope) IsActive() bool {
 	return e.stage != Off
 }
+
+// shape maps linear progress through a segment (0 to 1) onto the curve
+func (c EnvelopeCurve) shape(t float64) float64 {
+	k := float64(c)
+	if math.Abs(k) < 1e-6 {
+		return t
+	}
+	return (1.0 - math.Exp(-k*t)) / (1.0 - math.Exp(-k))
+}
@@ -0,0 +1,200 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+// renderEnvelope renders n samples of an envelope and returns their levels
+func renderEnvelope(e *Envelope, n int) []float64 {
+	levels := make([]float64, n)
+	for i := range levels {
+		levels[i] = e.Next()
+	}
+	return levels
+}
+
+func TestEnvelopeStages(t *testing.T) {
+	// At 1kHz: 5 samples of delay, 10 of attack, 5 of hold and 10 of decay
+	e := NewEnvelope(0.01, 0.01, 0.5, 0.01, 1000)
+	e.SetDelay(0.005)
+	e.SetHold(0.005)
+	e.Trigger()
+
+	tests := []struct {
+		sample int
+		stage  EnvelopeStage
+		level  float64
+	}{
+		{0, Delay, 0},
+		{4, Delay, 0},
+		{5, Attack, 0},
+		{10, Attack, 0.5},
+		{14, Attack, 0.9},
+		{15, Hold, 1},
+		{20, Hold, 1},
+		{21, Decay, 1},
+		{26, Decay, 0.75},
+		{31, Sustain, 0.5},
+		{100, Sustain, 0.5},
+	}
+
+	rendered := 0
+	for _, tt := range tests {
+		var level float64
+		for ; rendered <= tt.sample; rendered++ {
+			level = e.Next()
+		}
+		if math.Abs(level-tt.level) > 1e-9 {
+			t.Errorf("sample %d: level %.3f, want %.3f", tt.sample, level, tt.level)
+		}
+		if stage := e.GetStage(); stage != tt.stage {
+			t.Errorf("sample %d: stage %d, want %d", tt.sample, stage, tt.stage)
+		}
+	}
+
+	e.Release()
+	levels := renderEnvelope(e, 11)
+	if levels[5] != 0.25 || levels[10] != 0 || e.IsActive() {
+		t.Errorf("release levels %v, want 0.5 down to 0 over 10 samples", levels)
+	}
+}
+
+func TestEnvelopeCurves(t *testing.T) {
+	tests := []struct {
+		name    string
+		curve   EnvelopeCurve
+		attack  float64 // Level halfway through the attack
+		decay   float64 // Level halfway through the decay from 1 to 0.5
+		release float64 // Level halfway through the release from 0.5
+	}{
+		{"linear", CurveLinear, 0.5, 0.75, 0.25},
+		{"exponential", CurveExponential, 0.924, 0.538, 0.038},
+		{"slow start", -5, 0.076, 0.962, 0.462},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnvelope(0.1, 0.1, 0.5, 0.1, 1000)
+			e.SetCurve(tt.curve)
+			e.Trigger()
+
+			check := func(segment string, levels []float64, from, to, half float64) {
+				t.Helper()
+				if math.Abs(levels[0]-from) > 1e-9 || math.Abs(levels[100]-to) > 1e-9 {
+					t.Errorf("%s goes from %.3f to %.3f, want %.3f to %.3f", segment, levels[0], levels[100], from, to)
+				}
+				if math.Abs(levels[50]-half) > 0.001 {
+					t.Errorf("%s is at %.3f halfway, want %.3f", segment, levels[50], half)
+				}
+				for i := 1; i < len(levels); i++ {
+					if (levels[i]-levels[i-1])*(to-from) < 0 {
+						t.Fatalf("%s turns back at sample %d", segment, i)
+					}
+				}
+			}
+			check("attack", renderEnvelope(e, 101), 0, 1, tt.attack)
+			check("decay", renderEnvelope(e, 101), 1, 0.5, tt.decay)
+			e.Release()
+			check("release", renderEnvelope(e, 101), 0.5, 0, tt.release)
+		})
+	}
+}
+
+func TestEnvelopeReleaseFromCurrentLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples int     // Rendered before the release
+		level   float64 // Level when released
+	}{
+		{"during attack", 4, 0.3},
+		{"during decay", 15, 0.85},
+		{"during sustain", 50, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnvelope(0.01, 0.01, 0.5, 0.01, 1000)
+			e.Trigger()
+			renderEnvelope(e, tt.samples)
+			e.Release()
+
+			// The release starts where the note was and lasts its full time
+			levels := renderEnvelope(e, 11)
+			for i, level := range levels {
+				if want := tt.level * (1 - float64(i)/10); math.Abs(level-want) > 1e-9 {
+					t.Errorf("release sample %d: level %.3f, want %.3f", i, level, want)
+				}
+			}
+			if e.IsActive() {
+				t.Error("envelope still active after the release")
+			}
+		})
+	}
+}
+
+func TestEnvelopeRetrigger(t *testing.T) {
+	tests := []struct {
+		name   string
+		legato bool
+		stage  EnvelopeStage // Stage after retriggering a held note
+	}{
+		{"restart", false, Attack},
+		{"legato", true, Sustain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnvelope(0.01, 0.01, 0.5, 0.01, 1000)
+			e.SetLegato(tt.legato)
+			e.Trigger()
+			renderEnvelope(e, 50)
+
+			// A held note only restarts without legato, from its current level
+			e.Trigger()
+			if stage := e.GetStage(); stage != tt.stage {
+				t.Errorf("retriggered held note in stage %d, want %d", stage, tt.stage)
+			}
+			if level := e.Next(); math.Abs(level-0.5) > 1e-9 {
+				t.Errorf("retriggered held note jumps to %.3f", level)
+			}
+
+			// A released note always restarts, rising from where the release was
+			e.Release()
+			renderEnvelope(e, 5)
+			e.Trigger()
+			if stage := e.GetStage(); stage != Attack {
+				t.Errorf("retriggered released note in stage %d, want %d", stage, Attack)
+			}
+			levels := renderEnvelope(e, 11)
+			if math.Abs(levels[0]-0.3) > 1e-9 || levels[10] != 1 {
+				t.Errorf("attack after release goes from %.3f to %.3f, want 0.3 to 1", levels[0], levels[10])
+			}
+		})
+	}
+}
+
+func TestParseCurve(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    EnvelopeCurve
+		wantErr bool
+	}{
+		{value: "linear", want: CurveLinear},
+		{value: "exp", want: CurveExponential},
+		{value: "3", want: 3},
+		{value: "-2.5", want: -2.5},
+		{value: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCurve(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCurve(%q) error = %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCurve(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
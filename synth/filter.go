@@ -0,0 +1,103 @@
+package synth
+
+import (
+	"math"
+	"strings"
+)
+
+// FilterMode selects which response of the filter is heard
+type FilterMode int
+
+const (
+	FilterOff FilterMode = iota
+	LowPass
+	HighPass
+	BandPass
+	Notch
+)
+
+// filterModeNames are the names used by the "filter" instrument parameter
+var filterModeNames = map[string]FilterMode{
+	"off":   FilterOff,
+	"lp":    LowPass,
+	"hp":    HighPass,
+	"bp":    BandPass,
+	"notch": Notch,
+}
+
+// ParseFilterMode returns the filter mode for a name like "lp" or "notch"
+func ParseFilterMode(name string) (FilterMode, bool) {
+	mode, ok := filterModeNames[strings.ToLower(name)]
+	return mode, ok
+}
+
+// Filter is a resonant state-variable filter (topology-preserving
+// transform), which stays stable while the cutoff is swept
+type Filter struct {
+	mode       FilterMode
+	cutoff     float64 // Hz
+	resonance  float64 // 0.0 to 1.0 (self-oscillation)
+	sampleRate float64
+
+	g, k   float64 // Coefficients for the current cutoff and resonance
+	s1, s2 float64 // Integrator states
+}
+
+// NewFilter creates a filter, open (20kHz low-pass) until configured
+func NewFilter(mode FilterMode, sampleRate float64) *Filter {
+	f := &Filter{
+		mode:       mode,
+		sampleRate: sampleRate,
+	}
+	f.Set(20000.0, 0.0)
+	return f
+}
+
+// SetMode changes the filter response
+func (f *Filter) SetMode(mode FilterMode) {
+	f.mode = mode
+}
+
+// Set sets the cutoff frequency in Hz and the resonance (0.0 to 1.0)
+func (f *Filter) Set(cutoff, resonance float64) {
+	if cutoff == f.cutoff && resonance == f.resonance {
+		return
+	}
+	f.cutoff, f.resonance = cutoff, resonance
+
+	// Keep the cutoff below Nyquist where tan() blows up
+	cutoff = math.Max(10.0, math.Min(cutoff, f.sampleRate*0.49))
+	f.g = math.Tan(math.Pi * cutoff / f.sampleRate)
+	f.k = 2.0 - 2.0*math.Max(0.0, math.Min(resonance, 0.99))
+}
+
+// Reset clears the filter state
+func (f *Filter) Reset() {
+	f.s1, f.s2 = 0.0, 0.0
+}
+
+// Process filters one sample
+func (f *Filter) Process(x float64) float64 {
+	if f.mode == FilterOff {
+		return x
+	}
+
+	hp := (x - (f.k+f.g)*f.s1 - f.s2) / (1.0 + f.g*(f.g+f.k))
+	v1 := f.g * hp
+	bp := v1 + f.s1
+	f.s1 = bp + v1
+	v2 := f.g * bp
+	lp := v2 + f.s2
+	f.s2 = lp + v2
+
+	switch f.mode {
+	case HighPass:
+		return hp
+	case BandPass:
+		return bp
+	case Notch:
+		return lp + hp
+	default:
+		return lp
+	}
+}
@@ -0,0 +1,88 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+// sineGain returns the steady-state gain of a filter for a sine wave
+func sineGain(f *Filter, freq, sampleRate float64) float64 {
+	n := int(sampleRate)
+	var sum float64
+	for i := range n {
+		y := f.Process(math.Sin(2.0 * math.Pi * freq * float64(i) / sampleRate))
+		if i >= n/2 {
+			sum += y * y
+		}
+	}
+	return math.Sqrt(2.0 * sum / float64(n-n/2))
+}
+
+func TestFilterResponse(t *testing.T) {
+	const sampleRate = 44100.0
+
+	tests := []struct {
+		mode      FilterMode
+		cutoff    float64
+		resonance float64
+		freq      float64
+		want      float64 // Gain for a sine at freq
+		tolerance float64
+	}{
+		// Low-pass passes the lows, falls 12dB per octave above the cutoff
+		// and peaks at the cutoff by 1/(2-2*resonance)
+		{LowPass, 1000, 0, 50, 1.0, 0.01},
+		{LowPass, 1000, 0, 1000, 0.5, 0.01},
+		{LowPass, 1000, 0.5, 1000, 1.0, 0.02},
+		{LowPass, 1000, 0.9, 1000, 5.0, 0.1},
+		{LowPass, 1000, 0, 8000, 0.013, 0.005},
+		{LowPass, 200, 0, 1600, 0.0156, 0.005},
+
+		// High-pass mirrors it
+		{HighPass, 1000, 0, 15000, 1.0, 0.02},
+		{HighPass, 1000, 0, 1000, 0.5, 0.01},
+		{HighPass, 1000, 0.9, 1000, 5.0, 0.1},
+		{HighPass, 1000, 0, 125, 0.0156, 0.005},
+
+		// Band-pass peaks at the cutoff, notch removes it
+		{BandPass, 1000, 0, 1000, 0.5, 0.01},
+		{BandPass, 1000, 0.9, 1000, 5.0, 0.1},
+		{BandPass, 1000, 0.9, 4000, 0.259, 0.005},
+		{Notch, 1000, 0.5, 1000, 0.0, 0.01},
+		{Notch, 1000, 0.5, 100, 1.0, 0.02},
+		{Notch, 1000, 0.5, 10000, 1.0, 0.02},
+
+		{FilterOff, 100, 0.9, 5000, 1.0, 1e-6},
+	}
+
+	for _, tt := range tests {
+		f := NewFilter(tt.mode, sampleRate)
+		f.Set(tt.cutoff, tt.resonance)
+		if got := sineGain(f, tt.freq, sampleRate); math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("mode %d cutoff %g resonance %g: gain at %gHz = %.4f, want %.4f",
+				tt.mode, tt.cutoff, tt.resonance, tt.freq, got, tt.want)
+		}
+	}
+}
+
+func TestFilterSweepIsStable(t *testing.T) {
+	// Sweeping the cutoff up and down every few samples at full resonance
+	// must not blow up
+	f := NewFilter(LowPass, 44100)
+	o := NewOscillator(SawBL, 44100)
+	o.SetFrequency(110)
+
+	var peak float64
+	for i := range 44100 {
+		cutoff := 20.0 * math.Pow(1000.0, 0.5+0.5*math.Sin(float64(i)/500.0))
+		f.Set(cutoff, 1.0)
+		y := f.Process(o.Next())
+		if math.IsNaN(y) || math.IsInf(y, 0) {
+			t.Fatalf("sample %d is %f", i, y)
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	if peak > 100 {
+		t.Errorf("peak %.1f, want the resonance to stay bounded", peak)
+	}
+}
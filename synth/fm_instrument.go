@@ -1,5 +1,7 @@
 package synth
 
+import "math"
+
 // FMAlgorithm defines how operators are connected
 type FMAlgorithm int
 
@@ -24,13 +26,19 @@ const (
 )
 
 // FMInstrument implements multi-operator FM synthesis
+// Operators are connected by an FMRouting, built from an FMAlgorithm or
+// one of the DX7 and OPN tables
 type FMInstrument struct {
 	operators       []*FMOperator
-	algorithm       FMAlgorithm
-	modulationIndex float64 // Controls modulation depth (brightness)
+	routing         *FMRouting
+	modulationIndex float64   // Controls modulation depth (brightness)
+	feedback        float64   // Phase modulation depth of the feedback connection
+	outputs         []float64 // Latest output of each operator
+	feedbackPrev    float64   // Output of the feedback operator one sample earlier
 	sampleRate      float64
 	baseFrequency   float64
 	volume          float64
+	lfos            []*LFO
 }
 
 // NewFMInstrument creates a new FM instrument with specified number of operators
@@ -40,13 +48,14 @@ func NewFMInstrument(numOperators int, algorithm FMAlgorithm, sampleRate float64
 		operators[i] = NewFMOperator(sampleRate)
 	}
 
-	return &FMInstrument{
+	fm := &FMInstrument{
 		operators:       operators,
-		algorithm:       algorithm,
 		modulationIndex: 2.0,
 		sampleRate:      sampleRate,
 		volume:          1.0,
 	}
+	fm.SetRouting(algorithm.Routing())
+	return fm
 }
 
 // SetOperatorRatio sets the frequency ratio for an operator
@@ -89,14 +98,39 @@ func (fm *FMInstrument) NoteOn(note int, velocity float64) {
 	for i, op := range fm.operators {
 		op.SetFrequency(fm.baseFrequency)
 
+		// Use base level, not current level (prevents accumulation)
+		op.outputLevel = op.baseOutputLevel * op.levelScaling(fm.baseFrequency, velocity)
+
 		// Velocity affects modulator output levels more than carrier
-		if i > 0 { // Modulators
-			// Use base level, not current level (prevents accumulation)
-			op.outputLevel = op.baseOutputLevel * velocityModulation
+		if fm.routing.output[i] == 0 { // Modulators
+			op.outputLevel *= velocityModulation
 		}
 
 		op.Trigger()
 	}
+	for _, lfo := range fm.lfos {
+		lfo.Trigger()
+	}
+}
+
+// SetFrequency retunes all operators without retriggering their envelopes
+func (fm *FMInstrument) SetFrequency(freq float64) {
+	fm.baseFrequency = freq
+	for _, op := range fm.operators {
+		op.SetFrequency(freq)
+	}
+}
+
+// SetTempo sets the tempo in BPM for LFOs synced to it
+func (fm *FMInstrument) SetTempo(bpm float64) {
+	for _, lfo := range fm.lfos {
+		lfo.SetTempo(bpm)
+	}
+}
+
+// SetVolume changes the output volume without affecting brightness
+func (fm *FMInstrument) SetVolume(volume float64) {
+	fm.volume = volume
 }
 
 // NoteOff releases all operators
@@ -106,57 +140,55 @@ func (fm *FMInstrument) NoteOff() {
 	}
 }
 
-// Next generates the next audio sample based on the algorithm
+// Next generates the next audio sample based on the routing
 func (fm *FMInstrument) Next() float64 {
 	if len(fm.operators) == 0 {
 		return 0.0
 	}
 
-	var output float64
-
-	switch fm.algorithm {
-	case FM2OpSimple:
-		// Op2 modulates Op1
-		if len(fm.operators) >= 2 {
-			modulator := fm.operators[1].Next(0) * fm.modulationIndex
-			carrier := fm.operators[0].Next(modulator)
-			output = carrier
+	// LFO modulation
+	pitch, gain, index := 0.0, 1.0, fm.modulationIndex
+	for _, lfo := range fm.lfos {
+		out := lfo.Next()
+		switch lfo.target {
+		case LFOPitch:
+			pitch += out
+		case LFOAmp:
+			gain *= lfo.tremolo(out)
+		case LFOModIndex:
+			index += out
 		}
-
-	case FM2OpParallel:
-		// Both operators in parallel (additive)
-		if len(fm.operators) >= 2 {
-			output = (fm.operators[0].Next(0) + fm.operators[1].Next(0)) * 0.5
+	}
+	if len(fm.lfos) > 0 {
+		freq := fm.baseFrequency * math.Exp2(pitch/12.0)
+		for _, op := range fm.operators {
+			op.SetFrequency(freq)
 		}
+	}
 
-	case FM3OpStack:
-		// Op3 -> Op2 -> Op1
-		if len(fm.operators) >= 3 {
-			mod2 := fm.operators[2].Next(0) * fm.modulationIndex
-			mod1 := fm.operators[1].Next(mod2) * fm.modulationIndex
-			carrier := fm.operators[0].Next(mod1)
-			output = carrier
+	// Modulators run before the operators they modulate, so each operator
+	// sees this sample's output of its modulators
+	r := fm.routing
+	var output float64
+	for _, i := range r.order {
+		modulation := 0.0
+		for _, l := range r.inputs[i] {
+			modulation += fm.outputs[l.from] * l.depth * index
 		}
 
-	case FM4OpPiano:
-		// Classic 4-operator piano algorithm
-		// Op4 -> Op3 -> Op1 (modulation chain 1)
-		// Op2 -> Op1 (modulation chain 2)
-		if len(fm.operators) >= 4 {
-			// Chain 1: Op4 modulates Op3
-			mod4 := fm.operators[3].Next(0) * fm.modulationIndex * 0.5
-			mod3 := fm.operators[2].Next(mod4) * fm.modulationIndex
-
-			// Chain 2: Op2 modulates Op1
-			mod2 := fm.operators[1].Next(0) * fm.modulationIndex * 0.3
-
-			// Op1 is carrier, modulated by both chains
-			carrier := fm.operators[0].Next(mod3 + mod2)
-			output = carrier
+		// The feedback operator has not run yet, so its output is still the
+		// previous sample's; averaging two samples tames the feedback
+		if r.feedback.to == i && fm.feedback != 0 {
+			last := fm.outputs[r.feedback.from]
+			modulation += (last + fm.feedbackPrev) * 0.5 * fm.feedback
+			fm.feedbackPrev = last
 		}
+
+		fm.outputs[i] = fm.operators[i].Next(modulation)
+		output += fm.outputs[i] * r.output[i]
 	}
 
-	return output * fm.volume
+	return output * fm.volume * gain
 }
 
 // IsActive returns true if any operator is still active
@@ -169,6 +201,34 @@ func (fm *FMInstrument) IsActive() bool {
 	return false
 }
 
+// fmPresets maps the preset names used by FMINSTRUMENT to their constructors
+var fmPresets = map[string]func(sampleRate float64) *FMInstrument{
+	"PIANO":  NewPianoFMInstrument,
+	"EPIANO": NewElectricPianoFMInstrument,
+	"BASS":   NewFMBassFMInstrument,
+	"LEAD":   NewFMLeadFMInstrument,
+	"BRASS":  NewFMBrassFMInstrument,
+	"BELL":   NewFMBellFMInstrument,
+	"ARP":    NewFMArpFMInstrument,
+	"CUSTOM": NewCustomFMInstrument,
+}
+
+// NewFMPreset creates a preset FM instrument by name (e.g. "PIANO")
+// Returns false if there is no preset with that name
+func NewFMPreset(name string, sampleRate float64) (*FMInstrument, bool) {
+	newPreset, ok := fmPresets[name]
+	if !ok {
+		return nil, false
+	}
+	return newPreset(sampleRate), true
+}
+
+// IsFMPreset returns true if name is a known FM preset
+func IsFMPreset(name string) bool {
+	_, ok := fmPresets[name]
+	return ok
+}
+
 // NewPianoFMInstrument creates a preset FM instrument configured for piano sounds
 func NewPianoFMInstrument(sampleRate float64) *FMInstrument {
 	fm := NewFMInstrument(4, FM4OpPiano, sampleRate)
@@ -2,16 +2,44 @@ package synth
 
 import "math"
 
+// FMWaveform selects the waveform of an FM operator; besides the sine these
+// are the OPL2 waveforms
+type FMWaveform int
+
+const (
+	FMSine        FMWaveform = iota
+	FMHalfSine               // Positive half of the sine, silent otherwise
+	FMAbsSine                // Both halves positive
+	FMQuarterSine            // Rising quarter of each half, silent otherwise
+)
+
+// fmWaveformNames are the names used by the opN.wave parameter
+var fmWaveformNames = map[string]FMWaveform{
+	"sine":    FMSine,
+	"half":    FMHalfSine,
+	"abs":     FMAbsSine,
+	"quarter": FMQuarterSine,
+}
+
 // FMOperator represents an FM synthesis operator
 // An operator is an oscillator with its own envelope that can modulate other operators
 type FMOperator struct {
-	phase          float64
-	frequency      float64
-	sampleRate     float64
-	envelope       *Envelope
-	outputLevel    float64 // Current output volume (may be modulated by velocity)
+	phase           float64
+	frequency       float64
+	sampleRate      float64
+	envelope        *Envelope
+	outputLevel     float64 // Current output volume (may be modulated by velocity)
 	baseOutputLevel float64 // Base output level (for velocity modulation)
-	ratio          float64  // Frequency ratio (e.g., 1.0 = fundamental, 2.0 = octave up)
+	ratio           float64 // Frequency ratio (e.g., 1.0 = fundamental, 2.0 = octave up)
+	fixed           float64 // Fixed frequency in Hz, ignoring the note (0 = use ratio)
+	detune          float64 // Frequency factor from the fine detune
+
+	waveform     FMWaveform
+	feedback     float64 // Phase modulation depth of the self-feedback
+	prev1, prev2 float64 // Last two outputs, for feedback
+
+	keyScale     float64 // dB of attenuation per octave above C-4 (boost below)
+	velocitySens float64 // 0 ignores velocity, 1 scales the level by it
 }
 
 // NewFMOperator creates a new FM operator
@@ -23,12 +51,18 @@ func NewFMOperator(sampleRate float64) *FMOperator {
 		outputLevel:     1.0,
 		baseOutputLevel: 1.0,
 		ratio:           1.0,
+		detune:          1.0,
 	}
 }
 
 // SetEnvelope configures the operator's envelope
 func (op *FMOperator) SetEnvelope(attack, decay, sustain, release float64) {
-	op.envelope = NewEnvelope(attack, decay, sustain, release, op.sampleRate)
+	op.envelope.SetADSR(attack, decay, sustain, release)
+}
+
+// GetEnvelope returns the operator's envelope, e.g. to set its curve
+func (op *FMOperator) GetEnvelope() *Envelope {
+	return op.envelope
 }
 
 // SetRatio sets the frequency ratio relative to the fundamental
@@ -42,15 +76,69 @@ func (op *FMOperator) SetOutputLevel(level float64) {
 	op.outputLevel = level
 }
 
+// SetFixedFrequency makes the operator play at hz whatever the note
+// 0 goes back to following the note with the ratio
+func (op *FMOperator) SetFixedFrequency(hz float64) {
+	op.fixed = hz
+}
+
+// SetDetune detunes the operator by a number of cents
+func (op *FMOperator) SetDetune(cents float64) {
+	op.detune = math.Exp2(cents / 1200.0)
+}
+
+// SetWaveform sets the operator waveform
+func (op *FMOperator) SetWaveform(waveform FMWaveform) {
+	op.waveform = waveform
+}
+
+// SetFeedback feeds the operator's output back into its own phase, with a
+// level from 0 (off) to 7 as on the DX7 and OPN chips
+func (op *FMOperator) SetFeedback(level float64) {
+	op.feedback = feedbackDepth(level)
+}
+
+// SetKeyScaling attenuates the output level by dbPerOctave for each octave
+// above C-4, and boosts it below (negative values do the opposite)
+func (op *FMOperator) SetKeyScaling(dbPerOctave float64) {
+	op.keyScale = dbPerOctave
+}
+
+// SetVelocitySensitivity sets how much velocity scales the output level,
+// from 0 (not at all) to 1 (proportionally)
+func (op *FMOperator) SetVelocitySensitivity(sensitivity float64) {
+	op.velocitySens = sensitivity
+}
+
+// levelScaling returns the output level factor for a note at freq played
+// with velocity
+func (op *FMOperator) levelScaling(freq, velocity float64) float64 {
+	scale := 1.0 - op.velocitySens*(1.0-velocity)
+	if op.keyScale != 0 && freq > 0 {
+		octaves := math.Log2(freq / keyTrackingCenter)
+		scale *= math.Pow(10.0, -op.keyScale*octaves/20.0)
+	}
+	return scale
+}
+
 // SetFrequency sets the base frequency
 func (op *FMOperator) SetFrequency(freq float64) {
-	op.frequency = freq * op.ratio
+	if op.fixed > 0 {
+		freq = op.fixed
+	} else {
+		freq *= op.ratio
+	}
+	op.frequency = freq * op.detune
 }
 
 // Trigger starts the operator's envelope
 func (op *FMOperator) Trigger() {
+	if op.envelope.legato && op.envelope.isHeld() {
+		return // Legato: keep the phase running too
+	}
 	op.envelope.Trigger()
 	op.phase = 0.0
+	op.prev1, op.prev2 = 0.0, 0.0
 }
 
 // Release releases the operator's envelope
@@ -63,18 +151,46 @@ func (op *FMOperator) Release() {
 func (op *FMOperator) Next(modulation float64) float64 {
 	// Get envelope value
 	env := op.envelope.Next()
-	
-	// Generate sine wave with phase modulation
-	sample := math.Sin(2.0*math.Pi*op.phase + modulation)
-	
+
+	// Self-feedback averages the last two outputs to keep it stable
+	if op.feedback != 0 {
+		modulation += (op.prev1 + op.prev2) * 0.5 * op.feedback
+	}
+
+	// Generate the waveform with phase modulation
+	sample := op.waveform.sample(2.0*math.Pi*op.phase + modulation)
+
 	// Advance phase
 	phaseIncrement := op.frequency / op.sampleRate
 	op.phase += phaseIncrement
 	if op.phase >= 1.0 {
 		op.phase -= math.Floor(op.phase)
 	}
-	
-	return sample * env * op.outputLevel
+
+	out := sample * env * op.outputLevel
+	op.prev2, op.prev1 = op.prev1, out
+	return out
+}
+
+// sample returns the waveform at a phase in radians
+func (w FMWaveform) sample(theta float64) float64 {
+	s := math.Sin(theta)
+	switch w {
+	case FMHalfSine:
+		return math.Max(s, 0.0)
+	case FMAbsSine:
+		return math.Abs(s)
+	case FMQuarterSine:
+		half := math.Mod(theta, math.Pi)
+		if half < 0 {
+			half += math.Pi
+		}
+		if half < math.Pi/2.0 {
+			return math.Abs(s)
+		}
+		return 0.0
+	}
+	return s
 }
 
 // IsActive returns true if the operator's envelope is active
@@ -85,7 +201,6 @@ func (op *FMOperator) IsActive() bool {
 // Reset resets the operator
 func (op *FMOperator) Reset() {
 	op.phase = 0.0
-	op.envelope.stage = Off
-	op.envelope.level = 0.0
+	op.prev1, op.prev2 = 0.0, 0.0
+	op.envelope.Reset()
 }
-
@@ -0,0 +1,356 @@
+package synth
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FMParamError reports an FM instrument parameter that could not be applied
+type FMParamError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *FMParamError) Error() string {
+	return fmt.Sprintf("%s=%s: %v", e.Key, e.Value, e.Err)
+}
+
+func (e *FMParamError) Unwrap() error {
+	return e.Err
+}
+
+// OperatorCount returns the number of operators the algorithm uses
+func (a FMAlgorithm) OperatorCount() int {
+	switch a {
+	case FM3OpStack:
+		return 3
+	case FM4OpPiano:
+		return 4
+	default:
+		return 2
+	}
+}
+
+// NewCustomFMInstrument creates a neutral 2-operator instrument meant to be
+// shaped entirely by parameters (see ApplyParams)
+func NewCustomFMInstrument(sampleRate float64) *FMInstrument {
+	return NewFMInstrument(2, FM2OpSimple, sampleRate)
+}
+
+// SetAlgorithm changes how operators are connected, adding operators if the
+// algorithm needs more than the instrument has
+func (fm *FMInstrument) SetAlgorithm(algorithm FMAlgorithm) {
+	fm.SetRouting(algorithm.Routing())
+}
+
+// SetRouting connects the operators as described by a routing, adding
+// operators if it needs more than the instrument has
+// Operators the routing does not mention are carriers.
+func (fm *FMInstrument) SetRouting(routing *FMRouting) {
+	fm.routing = routing.clone()
+	if len(fm.operators) < routing.Operators() {
+		fm.SetOperatorCount(routing.Operators())
+	} else {
+		fm.SetOperatorCount(len(fm.operators))
+	}
+}
+
+// GetRouting returns how the operators are connected
+func (fm *FMInstrument) GetRouting() *FMRouting {
+	return fm.routing
+}
+
+// SetFeedback sets the level of the routing's feedback connection, from 0
+// (off) to 7 as on the DX7 and OPN chips
+// When the connection feeds an operator back into itself this is the same
+// setting as that operator's SetFeedback, so the two never add up.
+func (fm *FMInstrument) SetFeedback(level float64) {
+	if op := fm.routing.selfFeedback(); op >= 0 {
+		fm.operators[op].SetFeedback(level)
+		fm.feedback = 0.0
+		return
+	}
+	fm.feedback = feedbackDepth(level)
+}
+
+// SetOperatorCount grows or shrinks the operator list
+// New operators start at ratio 1.0 with the default envelope, as carriers
+func (fm *FMInstrument) SetOperatorCount(n int) {
+	for len(fm.operators) < n {
+		fm.operators = append(fm.operators, NewFMOperator(fm.sampleRate))
+	}
+	fm.operators = fm.operators[:n]
+	fm.routing.resize(n)
+	fm.outputs = make([]float64, n)
+	fm.feedbackPrev = 0.0
+}
+
+// ApplyParams applies key=value parameters as written on FMINSTRUMENT lines:
+//
+//	ops=4                    operator count
+//	alg=3                    algorithm (FM2OpSimple=0 .. FM4OpPiano=3),
+//	                         dx7:1 .. dx7:32 or opn:0 .. opn:7 (also opm:)
+//	route=2>1,4>3,3>1,4>4    custom routing, see ParseFMRouting
+//	fb=5                     feedback level from 0 to 7 (on an operator feeding
+//	                         itself, the same setting as its opN.fb)
+//	mod=2.5                  modulation index
+//	curve=exp                envelope curve of every operator (see Voice.ApplyParams)
+//	legato=1                 new notes glide without restarting held envelopes
+//	op1.ratio=2              frequency ratio of operator 1 (the carrier)
+//	op2.level=0.7            output level of operator 2
+//	op2.adsr=0.001,0.1,0.5,0.2
+//	op2.curve=exp            envelope curve of operator 2
+//	op2.delay=0.05           seconds before operator 2's attack starts
+//	op2.hold=0.1             seconds operator 2 holds full level after its attack
+//	op2.fb=5                 self-feedback level of operator 2, from 0 to 7
+//	op2.wave=half            waveform: sine, half, abs or quarter (OPL2)
+//	op2.fixed=440            fixed frequency in Hz, ignoring the note (0 = ratio)
+//	op2.detune=-7            fine detune in cents
+//	op2.keyscale=1.5         dB of attenuation per octave above C-4
+//	op2.velsens=0.8          velocity sensitivity of the level, from 0 to 1
+//	lfo1.target=mod          LFO target: pitch, amp or mod (modulation index)
+//	lfo1.rate=1/4            see Voice.ApplyParams for the other LFO parameters
+//
+// Invalid parameters are skipped; the returned error joins one FMParamError
+// for each of them.
+func (fm *FMInstrument) ApplyParams(params map[string]string) error {
+	var errs []error
+
+	// Operator count and algorithm first, so operator keys can refer to them
+	keys := slices.Sorted(maps.Keys(params))
+	slices.SortStableFunc(keys, func(a, b string) int {
+		return paramPriority(a) - paramPriority(b)
+	})
+
+	_, hasOps := params["ops"]
+	for _, key := range keys {
+		count := len(fm.operators)
+		if err := fm.setParam(key, params[key], params); err != nil {
+			errs = append(errs, &FMParamError{Key: key, Value: params[key], Err: err})
+			continue
+		}
+
+		// Without an explicit operator count the routing decides it
+		if hasOps && key != "ops" && len(fm.operators) > count {
+			errs = append(errs, &FMParamError{
+				Key:   "ops",
+				Value: params["ops"],
+				Err:   fmt.Errorf("%s=%s needs %d operators", key, params[key], len(fm.operators)),
+			})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func paramPriority(key string) int {
+	switch key {
+	case "ops":
+		return 0
+	case "alg", "route":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// setParam applies one parameter, params being all of them so conflicting
+// keys can be reported
+func (fm *FMInstrument) setParam(key, value string, params map[string]string) error {
+	lfos, handled, err := setLFOParam(fm.lfos, key, value, fm.sampleRate,
+		LFOPitch, LFOAmp, LFOModIndex)
+	fm.lfos = lfos
+	if handled {
+		return err
+	}
+
+	switch key {
+	case "ops":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("expected a positive operator count")
+		}
+		fm.SetOperatorCount(n)
+		return nil
+
+	case "alg":
+		routing, err := parseFMAlgorithm(value)
+		if err != nil {
+			return err
+		}
+		fm.SetRouting(routing)
+		return nil
+
+	case "route":
+		routing, err := ParseFMRouting(value, 1)
+		if err != nil {
+			return err
+		}
+		fm.SetRouting(routing)
+		return nil
+
+	case "fb":
+		level, err := strconv.ParseFloat(value, 64)
+		if err != nil || level < 0 || level > 7 {
+			return fmt.Errorf("expected a feedback level from 0 to 7")
+		}
+		if !fm.routing.HasFeedback() {
+			return fmt.Errorf("the routing has no feedback connection")
+		}
+		if op := fm.routing.selfFeedback(); op >= 0 {
+			if _, ok := params[fmt.Sprintf("op%d.fb", op+1)]; ok {
+				return fmt.Errorf("op%d.fb also sets the feedback of operator %d", op+1, op+1)
+			}
+		}
+		fm.SetFeedback(level)
+		return nil
+
+	case "mod":
+		index, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		fm.SetModulationIndex(index)
+		return nil
+
+	case "curve":
+		curve, err := parseCurve(value)
+		if err != nil {
+			return err
+		}
+		for _, op := range fm.operators {
+			op.envelope.SetCurve(curve)
+		}
+		return nil
+
+	case "legato":
+		legato, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected 0 or 1")
+		}
+		for _, op := range fm.operators {
+			op.envelope.SetLegato(legato)
+		}
+		return nil
+	}
+
+	// Operator parameters: op<N>.<name>, operators numbered from 1
+	opName, name, ok := strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(opName, "op") {
+		return fmt.Errorf("unknown parameter")
+	}
+	n, err := strconv.Atoi(opName[2:])
+	if err != nil || n < 1 {
+		return fmt.Errorf("unknown parameter")
+	}
+	if n > len(fm.operators) {
+		return fmt.Errorf("instrument has %d operators", len(fm.operators))
+	}
+	op := n - 1
+
+	switch name {
+	case "ratio":
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio <= 0 {
+			return fmt.Errorf("expected a positive number")
+		}
+		fm.SetOperatorRatio(op, ratio)
+
+	case "level":
+		level, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		fm.SetOperatorLevel(op, level)
+
+	case "adsr":
+		adsr, err := parseFloats(value, 4)
+		if err != nil {
+			return err
+		}
+		fm.SetOperatorEnvelope(op, adsr[0], adsr[1], adsr[2], adsr[3])
+
+	case "curve":
+		curve, err := parseCurve(value)
+		if err != nil {
+			return err
+		}
+		fm.operators[op].envelope.SetCurve(curve)
+
+	case "delay", "hold":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("expected a time in seconds")
+		}
+		if name == "delay" {
+			fm.operators[op].envelope.SetDelay(seconds)
+		} else {
+			fm.operators[op].envelope.SetHold(seconds)
+		}
+
+	case "fb":
+		level, err := strconv.ParseFloat(value, 64)
+		if err != nil || level < 0 || level > 7 {
+			return fmt.Errorf("expected a feedback level from 0 to 7")
+		}
+		fm.operators[op].SetFeedback(level)
+
+	case "wave":
+		waveform, ok := fmWaveformNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("expected sine, half, abs or quarter")
+		}
+		fm.operators[op].SetWaveform(waveform)
+
+	case "fixed":
+		hz, err := strconv.ParseFloat(value, 64)
+		if err != nil || hz < 0 {
+			return fmt.Errorf("expected a frequency in Hz")
+		}
+		fm.operators[op].SetFixedFrequency(hz)
+
+	case "detune", "keyscale":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		if name == "detune" {
+			fm.operators[op].SetDetune(v)
+		} else {
+			fm.operators[op].SetKeyScaling(v)
+		}
+
+	case "velsens":
+		sensitivity, err := strconv.ParseFloat(value, 64)
+		if err != nil || sensitivity < 0 || sensitivity > 1 {
+			return fmt.Errorf("expected a number from 0 to 1")
+		}
+		fm.operators[op].SetVelocitySensitivity(sensitivity)
+
+	default:
+		return fmt.Errorf("unknown operator parameter %q", name)
+	}
+	return nil
+}
+
+// parseFloats parses n comma-separated numbers
+func parseFloats(value string, n int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated numbers", n)
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected %d comma-separated numbers", n)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,79 @@
+package synth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFMFeedbackParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[string]string
+		wantErrKey string    // Key of the FMParamError expected, "" for none
+		wantOp     []float64 // Self-feedback level of each operator
+		wantLoop   float64   // Level of the instrument's feedback loop
+	}{
+		{
+			name:   "fb on a self-feedback routing sets the operator",
+			params: map[string]string{"alg": "opn:0", "fb": "5"},
+			wantOp: []float64{5, 0, 0, 0},
+		},
+		{
+			name:   "op fb alone",
+			params: map[string]string{"alg": "opn:0", "op3.fb": "2"},
+			wantOp: []float64{0, 0, 2, 0},
+		},
+		{
+			name:       "fb and op fb on the same operator",
+			params:     map[string]string{"alg": "opn:0", "fb": "5", "op1.fb": "3"},
+			wantErrKey: "fb",
+			wantOp:     []float64{3, 0, 0, 0},
+		},
+		{
+			name:   "fb and op fb on different operators",
+			params: map[string]string{"alg": "dx7:1", "fb": "6", "op2.fb": "3"},
+			wantOp: []float64{0, 3, 0, 0, 0, 6},
+		},
+		{
+			name:     "fb on a feedback loop across operators",
+			params:   map[string]string{"alg": "dx7:4", "fb": "7", "op6.fb": "1"},
+			wantOp:   []float64{0, 0, 0, 0, 0, 1},
+			wantLoop: 7,
+		},
+		{
+			name:       "fb without a feedback connection",
+			params:     map[string]string{"alg": "1", "fb": "4"},
+			wantErrKey: "fb",
+			wantOp:     []float64{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm := NewCustomFMInstrument(44100)
+			err := fm.ApplyParams(tt.params)
+
+			var paramErr *FMParamError
+			switch {
+			case tt.wantErrKey == "" && err != nil:
+				t.Errorf("ApplyParams: %v", err)
+			case tt.wantErrKey != "" && !errors.As(err, &paramErr):
+				t.Errorf("ApplyParams = %v, want an error for %s", err, tt.wantErrKey)
+			case tt.wantErrKey != "" && paramErr.Key != tt.wantErrKey:
+				t.Errorf("error for %s, want %s: %v", paramErr.Key, tt.wantErrKey, err)
+			}
+
+			if len(fm.operators) != len(tt.wantOp) {
+				t.Fatalf("%d operators, want %d", len(fm.operators), len(tt.wantOp))
+			}
+			for i, op := range fm.operators {
+				if want := feedbackDepth(tt.wantOp[i]); op.feedback != want {
+					t.Errorf("operator %d feedback = %f, want %f", i+1, op.feedback, want)
+				}
+			}
+			if want := feedbackDepth(tt.wantLoop); fm.feedback != want {
+				t.Errorf("loop feedback = %f, want %f", fm.feedback, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FMRouting describes how the operators of an FM instrument are connected.
+// Any operator can modulate any other, and the operators that modulate
+// nothing are carriers, summed into the output. One feedback connection can
+// feed an operator's previous output back into itself or into an operator
+// further up its modulation chain (see FMInstrument.SetFeedback).
+// Operators are numbered from 0.
+type FMRouting struct {
+	operators int
+	links     []fmLink
+	feedback  fmLink // from is -1 when there is no feedback connection
+
+	order  []int      // Evaluation order, modulators before what they modulate
+	inputs [][]fmLink // Connections into each operator
+	output []float64  // Mix level of each operator (0 for modulators)
+}
+
+// fmLink is one modulation connection
+type fmLink struct {
+	from, to int
+	depth    float64 // Multiplied by the modulation index
+}
+
+// NewFMRouting creates a routing where every operator is a carrier
+func NewFMRouting(operators int) *FMRouting {
+	r := &FMRouting{
+		operators: operators,
+		feedback:  fmLink{from: -1, to: -1},
+	}
+	r.update()
+	return r
+}
+
+// Operators returns the number of operators the routing connects
+func (r *FMRouting) Operators() int {
+	return r.operators
+}
+
+// Connect makes operator from modulate operator to, with a depth that is
+// multiplied by the modulation index (the built-in tables use 1)
+// Connections that would form a loop are rejected, see SetFeedback
+func (r *FMRouting) Connect(from, to int, depth float64) error {
+	if err := r.check(from, to); err != nil {
+		return err
+	}
+	if r.reaches(to, from) {
+		return fmt.Errorf("operator %d modulating operator %d would form a loop", from+1, to+1)
+	}
+	r.links = append(r.links, fmLink{from: from, to: to, depth: depth})
+	r.update()
+	return nil
+}
+
+// SetFeedback feeds the previous output of operator from back into operator
+// to, which must be the same operator or one that modulates it
+func (r *FMRouting) SetFeedback(from, to int) error {
+	if err := r.check(from, to); err != nil {
+		return err
+	}
+	if !r.reaches(to, from) {
+		return fmt.Errorf("operator %d does not modulate operator %d", to+1, from+1)
+	}
+	r.feedback = fmLink{from: from, to: to, depth: 1.0}
+	return nil
+}
+
+// HasFeedback returns true if the routing has a feedback connection
+func (r *FMRouting) HasFeedback() bool {
+	return r.feedback.from >= 0
+}
+
+// selfFeedback returns the operator the feedback connection feeds back into
+// itself, or -1 if there is none or it spans several operators
+func (r *FMRouting) selfFeedback() int {
+	if r.feedback.from >= 0 && r.feedback.from == r.feedback.to {
+		return r.feedback.from
+	}
+	return -1
+}
+
+// Carriers returns the operators mixed into the output
+func (r *FMRouting) Carriers() []int {
+	var carriers []int
+	for op, level := range r.output {
+		if level > 0 {
+			carriers = append(carriers, op)
+		}
+	}
+	return carriers
+}
+
+// check returns an error if an operator is not part of the routing
+func (r *FMRouting) check(ops ...int) error {
+	for _, op := range ops {
+		if op < 0 || op >= r.operators {
+			return fmt.Errorf("no operator %d in a %d-operator routing", op+1, r.operators)
+		}
+	}
+	return nil
+}
+
+// reaches returns true if operator from is operator to or modulates it,
+// directly or through other operators
+func (r *FMRouting) reaches(from, to int) bool {
+	if from == to {
+		return true
+	}
+	for _, l := range r.links {
+		if l.from == from && r.reaches(l.to, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// update works out the evaluation order and the carriers
+func (r *FMRouting) update() {
+	r.inputs = make([][]fmLink, r.operators)
+	modulates := make([]bool, r.operators)
+	for _, l := range r.links {
+		r.inputs[l.to] = append(r.inputs[l.to], l)
+		modulates[l.from] = true
+	}
+
+	r.order = r.order[:0]
+	visited := make([]bool, r.operators)
+	var visit func(op int)
+	visit = func(op int) {
+		if visited[op] {
+			return
+		}
+		visited[op] = true
+		for _, l := range r.inputs[op] {
+			visit(l.from)
+		}
+		r.order = append(r.order, op)
+	}
+	for op := range r.operators {
+		visit(op)
+	}
+
+	// Carriers share the output equally
+	carriers := 0
+	for _, m := range modulates {
+		if !m {
+			carriers++
+		}
+	}
+	r.output = make([]float64, r.operators)
+	for op, m := range modulates {
+		if !m {
+			r.output[op] = 1.0 / float64(carriers)
+		}
+	}
+}
+
+// resize changes the number of operators, dropping the connections of
+// removed operators; added operators are carriers
+func (r *FMRouting) resize(operators int) {
+	links := r.links[:0:0]
+	for _, l := range r.links {
+		if l.from < operators && l.to < operators {
+			links = append(links, l)
+		}
+	}
+	r.links = links
+	if r.feedback.from >= operators || r.feedback.to >= operators {
+		r.feedback = fmLink{from: -1, to: -1}
+	}
+	r.operators = operators
+	r.update()
+}
+
+// clone returns a copy that can be resized independently
+func (r *FMRouting) clone() *FMRouting {
+	c := *r
+	c.links = append([]fmLink(nil), r.links...)
+	c.order = nil
+	c.update()
+	return &c
+}
+
+// Routing returns the connections of the algorithm
+func (a FMAlgorithm) Routing() *FMRouting {
+	var r *FMRouting
+	switch a {
+	case FM2OpParallel:
+		r = NewFMRouting(2)
+	case FM3OpStack:
+		r = NewFMRouting(3)
+		r.Connect(2, 1, 1.0)
+		r.Connect(1, 0, 1.0)
+	case FM4OpPiano:
+		r = NewFMRouting(4)
+		r.Connect(3, 2, 0.5)
+		r.Connect(2, 0, 1.0)
+		r.Connect(1, 0, 0.3)
+	default:
+		r = NewFMRouting(2)
+		r.Connect(1, 0, 1.0)
+	}
+	return r
+}
+
+// dx7Algorithms are the 32 algorithms of the Yamaha DX7, with operators
+// numbered as on the DX7 (the carriers are the operators that modulate
+// nothing, the last connection of each closes the feedback loop)
+var dx7Algorithms = [32]string{
+	"2>1,6>5,5>4,4>3,6>6",
+	"2>1,6>5,5>4,4>3,2>2",
+	"3>2,2>1,6>5,5>4,6>6",
+	"3>2,2>1,6>5,5>4,4>6",
+	"2>1,4>3,6>5,6>6",
+	"2>1,4>3,6>5,5>6",
+	"2>1,4>3,6>5,5>3,6>6",
+	"2>1,4>3,6>5,5>3,4>4",
+	"2>1,4>3,6>5,5>3,2>2",
+	"3>2,2>1,5>4,6>4,3>3",
+	"3>2,2>1,5>4,6>4,6>6",
+	"2>1,4>3,5>3,6>3,2>2",
+	"2>1,4>3,5>3,6>3,6>6",
+	"2>1,4>3,5>4,6>4,6>6",
+	"2>1,4>3,5>4,6>4,2>2",
+	"2>1,4>3,3>1,6>5,5>1,6>6",
+	"2>1,4>3,3>1,6>5,5>1,2>2",
+	"2>1,3>1,6>5,5>4,4>1,3>3",
+	"3>2,2>1,6>4,6>5,6>6",
+	"3>1,3>2,5>4,6>4,3>3",
+	"3>1,3>2,6>4,6>5,3>3",
+	"2>1,6>3,6>4,6>5,6>6",
+	"3>2,6>4,6>5,6>6",
+	"6>3,6>4,6>5,6>6",
+	"6>4,6>5,6>6",
+	"3>2,5>4,6>4,6>6",
+	"3>2,5>4,6>4,3>3",
+	"2>1,4>3,5>4,5>5",
+	"4>3,6>5,6>6",
+	"4>3,5>4,5>5",
+	"6>5,6>6",
+	"6>6",
+}
+
+// opnAlgorithms are the 8 algorithms of the Yamaha OPN and OPM chips
+// (YM2612, YM2151...), with operators numbered as on the chips, where
+// operator 1 has feedback
+var opnAlgorithms = [8]string{
+	"1>2,2>3,3>4,1>1",
+	"1>3,2>3,3>4,1>1",
+	"1>4,2>3,3>4,1>1",
+	"1>2,2>4,3>4,1>1",
+	"1>2,3>4,1>1",
+	"1>2,1>3,1>4,1>1",
+	"1>2,1>1",
+	"1>1",
+}
+
+// DX7Algorithm returns the routing of DX7 algorithm n (1 to 32) for six
+// operators, with operator 1 of the DX7 as operator 0
+func DX7Algorithm(n int) (*FMRouting, bool) {
+	if n < 1 || n > len(dx7Algorithms) {
+		return nil, false
+	}
+	r, err := ParseFMRouting(dx7Algorithms[n-1], 6)
+	return r, err == nil
+}
+
+// OPNAlgorithm returns the routing of OPN/OPM algorithm n (0 to 7) for
+// four operators, with operator 1 of the chip as operator 0
+func OPNAlgorithm(n int) (*FMRouting, bool) {
+	if n < 0 || n >= len(opnAlgorithms) {
+		return nil, false
+	}
+	r, err := ParseFMRouting(opnAlgorithms[n], 4)
+	return r, err == nil
+}
+
+// ParseFMRouting parses connections like "2>1,4>3,3>1" between operators
+// numbered from 1, for at least the given number of operators
+// The connection that closes a loop (like "4>4") is the feedback connection;
+// there can only be one.
+func ParseFMRouting(s string, operators int) (*FMRouting, error) {
+	var links []fmLink
+	for _, part := range strings.Split(s, ",") {
+		a, b, ok := strings.Cut(part, ">")
+		from, errA := strconv.Atoi(a)
+		to, errB := strconv.Atoi(b)
+		if !ok || errA != nil || errB != nil || from < 1 || to < 1 {
+			return nil, fmt.Errorf("expected connections like 2>1,3>2")
+		}
+		links = append(links, fmLink{from: from - 1, to: to - 1, depth: 1.0})
+		operators = max(operators, from, to)
+	}
+
+	r := NewFMRouting(operators)
+	for _, l := range links {
+		if !r.reaches(l.to, l.from) {
+			r.links = append(r.links, l)
+			continue
+		}
+		if r.HasFeedback() {
+			return nil, fmt.Errorf("only one connection can close a feedback loop")
+		}
+		r.feedback = l
+	}
+	r.update()
+	return r, nil
+}
+
+// parseFMAlgorithm parses the value of the alg parameter: 0 to 3 for the
+// FMAlgorithm constants, dx7:1 to dx7:32, or opn:0 to opn:7 (opm:0 to opm:7)
+func parseFMAlgorithm(value string) (*FMRouting, error) {
+	family, num, ok := strings.Cut(strings.ToLower(value), ":")
+	if !ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < int(FM2OpSimple) || n > int(FM4OpPiano) {
+			return nil, fmt.Errorf("expected an algorithm from %d to %d, dx7:N or opn:N", FM2OpSimple, FM4OpPiano)
+		}
+		return FMAlgorithm(n).Routing(), nil
+	}
+
+	n, err := strconv.Atoi(num)
+	switch family {
+	case "dx7":
+		if r, ok := DX7Algorithm(n); err == nil && ok {
+			return r, nil
+		}
+		return nil, fmt.Errorf("expected a DX7 algorithm from 1 to %d", len(dx7Algorithms))
+	case "opn", "opm":
+		if r, ok := OPNAlgorithm(n); err == nil && ok {
+			return r, nil
+		}
+		return nil, fmt.Errorf("expected an OPN algorithm from 0 to %d", len(opnAlgorithms)-1)
+	}
+	return nil, fmt.Errorf("unknown algorithm family %q, expected dx7 or opn", family)
+}
+
+// feedbackDepth converts a DX7/OPN style feedback level (0 to 7) into the
+// phase modulation depth of the feedback connection, where each level
+// doubles it and level 7 feeds back ±π radians
+func feedbackDepth(level float64) float64 {
+	if level <= 0 {
+		return 0.0
+	}
+	return math.Pi * math.Exp2(level-7.0)
+}
@@ -0,0 +1,190 @@
+package synth
+
+import (
+	"slices"
+	"testing"
+)
+
+// checkRouting compares the carriers and feedback connection of a routing,
+// with operators numbered from 1 as in the chip manuals
+func checkRouting(t *testing.T, r *FMRouting, carriers []int, fbFrom, fbTo int) {
+	t.Helper()
+
+	var got []int
+	for _, op := range r.Carriers() {
+		got = append(got, op+1)
+	}
+	if !slices.Equal(got, carriers) {
+		t.Errorf("carriers = %v, want %v", got, carriers)
+	}
+	if from, to := r.feedback.from+1, r.feedback.to+1; from != fbFrom || to != fbTo {
+		t.Errorf("feedback = %d>%d, want %d>%d", from, to, fbFrom, fbTo)
+	}
+
+	// Every modulator must run before the operators it modulates
+	position := make([]int, r.Operators())
+	for i, op := range r.order {
+		position[op] = i
+	}
+	if len(r.order) != r.Operators() {
+		t.Errorf("evaluation order %v does not hold every operator", r.order)
+	}
+	for _, l := range r.links {
+		if position[l.from] > position[l.to] {
+			t.Errorf("operator %d runs after operator %d it modulates", l.from+1, l.to+1)
+		}
+	}
+}
+
+func TestDX7Algorithms(t *testing.T) {
+	tests := []struct {
+		carriers     []int
+		fbFrom, fbTo int
+	}{
+		{[]int{1, 3}, 6, 6},
+		{[]int{1, 3}, 2, 2},
+		{[]int{1, 4}, 6, 6},
+		{[]int{1, 4}, 4, 6},
+		{[]int{1, 3, 5}, 6, 6},
+		{[]int{1, 3, 5}, 5, 6},
+		{[]int{1, 3}, 6, 6},
+		{[]int{1, 3}, 4, 4},
+		{[]int{1, 3}, 2, 2},
+		{[]int{1, 4}, 3, 3},
+		{[]int{1, 4}, 6, 6},
+		{[]int{1, 3}, 2, 2},
+		{[]int{1, 3}, 6, 6},
+		{[]int{1, 3}, 6, 6},
+		{[]int{1, 3}, 2, 2},
+		{[]int{1}, 6, 6},
+		{[]int{1}, 2, 2},
+		{[]int{1}, 3, 3},
+		{[]int{1, 4, 5}, 6, 6},
+		{[]int{1, 2, 4}, 3, 3},
+		{[]int{1, 2, 4, 5}, 3, 3},
+		{[]int{1, 3, 4, 5}, 6, 6},
+		{[]int{1, 2, 4, 5}, 6, 6},
+		{[]int{1, 2, 3, 4, 5}, 6, 6},
+		{[]int{1, 2, 3, 4, 5}, 6, 6},
+		{[]int{1, 2, 4}, 6, 6},
+		{[]int{1, 2, 4}, 3, 3},
+		{[]int{1, 3, 6}, 5, 5},
+		{[]int{1, 2, 3, 5}, 6, 6},
+		{[]int{1, 2, 3, 6}, 5, 5},
+		{[]int{1, 2, 3, 4, 5}, 6, 6},
+		{[]int{1, 2, 3, 4, 5, 6}, 6, 6},
+	}
+
+	for i, tt := range tests {
+		r, ok := DX7Algorithm(i + 1)
+		if !ok {
+			t.Errorf("DX7Algorithm(%d) failed", i+1)
+			continue
+		}
+		if r.Operators() != 6 {
+			t.Errorf("DX7Algorithm(%d) has %d operators, want 6", i+1, r.Operators())
+		}
+		t.Logf("algorithm %d", i+1)
+		checkRouting(t, r, tt.carriers, tt.fbFrom, tt.fbTo)
+	}
+
+	for _, n := range []int{0, 33} {
+		if _, ok := DX7Algorithm(n); ok {
+			t.Errorf("DX7Algorithm(%d) succeeded", n)
+		}
+	}
+}
+
+func TestOPNAlgorithms(t *testing.T) {
+	tests := [][]int{
+		{4},
+		{4},
+		{4},
+		{4},
+		{2, 4},
+		{2, 3, 4},
+		{2, 3, 4},
+		{1, 2, 3, 4},
+	}
+
+	for n, carriers := range tests {
+		r, ok := OPNAlgorithm(n)
+		if !ok {
+			t.Errorf("OPNAlgorithm(%d) failed", n)
+			continue
+		}
+		t.Logf("algorithm %d", n)
+		checkRouting(t, r, carriers, 1, 1)
+	}
+
+	for _, n := range []int{-1, 8} {
+		if _, ok := OPNAlgorithm(n); ok {
+			t.Errorf("OPNAlgorithm(%d) succeeded", n)
+		}
+	}
+}
+
+func TestParseFMRouting(t *testing.T) {
+	tests := []struct {
+		in           string
+		operators    int
+		wantErr      bool
+		carriers     []int
+		fbFrom, fbTo int
+	}{
+		{in: "2>1", operators: 2, carriers: []int{1}},
+		{in: "2>1", operators: 4, carriers: []int{1, 3, 4}},
+		{in: "3>1,3>2,3>3", operators: 1, carriers: []int{1, 2}, fbFrom: 3, fbTo: 3},
+		{in: "2>1,3>2,1>3", operators: 3, carriers: []int{1}, fbFrom: 1, fbTo: 3},
+		{in: "2>2,3>3", operators: 3, wantErr: true},
+		{in: "2-1", operators: 2, wantErr: true},
+		{in: "0>1", operators: 2, wantErr: true},
+		{in: "", operators: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseFMRouting(tt.in, tt.operators)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseFMRouting(%q) succeeded", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFMRouting(%q): %v", tt.in, err)
+			continue
+		}
+		t.Logf("routing %q", tt.in)
+		checkRouting(t, r, tt.carriers, tt.fbFrom, tt.fbTo)
+	}
+}
+
+func TestParseFMAlgorithm(t *testing.T) {
+	tests := []struct {
+		in        string
+		operators int
+		wantErr   bool
+	}{
+		{in: "0", operators: 2},
+		{in: "3", operators: 4},
+		{in: "DX7:32", operators: 6},
+		{in: "opn:7", operators: 4},
+		{in: "opm:4", operators: 4},
+		{in: "4", wantErr: true},
+		{in: "dx7:33", wantErr: true},
+		{in: "opn:x", wantErr: true},
+		{in: "ymf:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseFMAlgorithm(tt.in)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("parseFMAlgorithm(%q) succeeded", tt.in)
+		case !tt.wantErr && err != nil:
+			t.Errorf("parseFMAlgorithm(%q): %v", tt.in, err)
+		case !tt.wantErr && r.Operators() != tt.operators:
+			t.Errorf("parseFMAlgorithm(%q) has %d operators, want %d", tt.in, r.Operators(), tt.operators)
+		}
+	}
+}
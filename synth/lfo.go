@@ -0,0 +1,270 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LFOShape selects the waveform of an LFO
+type LFOShape int
+
+const (
+	LFOSine LFOShape = iota
+	LFOTriangle
+	LFOSquare
+	LFOSampleHold // A new random level every cycle
+)
+
+// LFOTarget selects what an LFO modulates, which also sets the unit of
+// its depth
+type LFOTarget int
+
+const (
+	LFOPitch      LFOTarget = iota // Semitones (vibrato)
+	LFOAmp                         // Fraction of the volume, 0 to 1 (tremolo)
+	LFOPulseWidth                  // Pulse width units
+	LFOCutoff                      // Octaves of filter cutoff
+	LFOModIndex                    // Added to the FM modulation index
+)
+
+// Names used by the lfoN.shape and lfoN.target instrument parameters
+var (
+	lfoShapeNames = map[string]LFOShape{
+		"sine":   LFOSine,
+		"tri":    LFOTriangle,
+		"square": LFOSquare,
+		"sh":     LFOSampleHold,
+	}
+	lfoTargetNames = map[string]LFOTarget{
+		"pitch":  LFOPitch,
+		"amp":    LFOAmp,
+		"pw":     LFOPulseWidth,
+		"cutoff": LFOCutoff,
+		"mod":    LFOModIndex,
+	}
+)
+
+// maxLFOs limits how many LFOs an instrument can define
+const maxLFOs = 8
+
+// LFO is a low-frequency oscillator for modulating instrument parameters.
+// The rate is either free in Hz or synced to the tempo, and the LFO can wait
+// and fade in after each note starts.
+type LFO struct {
+	shape      LFOShape
+	target     LFOTarget
+	rate       float64 // Hz, when not synced
+	sync       float64 // Period in whole notes (0 = free running)
+	tempo      float64 // BPM for synced rates
+	depth      float64
+	delay      float64 // Seconds before the LFO starts
+	fade       float64 // Seconds to fade in after the delay
+	sampleRate float64
+
+	phase     float64
+	elapsed   int     // Samples since the note started
+	fadeLevel float64 // Current fade-in level (0.0 to 1.0)
+	held      float64 // Sample and hold level
+	rng       *rand.Rand
+}
+
+// NewLFO creates a 5Hz sine LFO targeting pitch, with no depth
+func NewLFO(sampleRate float64) *LFO {
+	return &LFO{
+		shape:      LFOSine,
+		target:     LFOPitch,
+		rate:       5.0,
+		tempo:      120.0,
+		sampleRate: sampleRate,
+		fadeLevel:  1.0,
+		rng:        rand.New(rand.NewPCG(DefaultNoiseSeed, 1)),
+	}
+}
+
+// SetShape sets the LFO waveform
+func (l *LFO) SetShape(shape LFOShape) {
+	l.shape = shape
+}
+
+// SetTarget sets what the LFO modulates
+func (l *LFO) SetTarget(target LFOTarget) {
+	l.target = target
+}
+
+// GetTarget returns what the LFO modulates
+func (l *LFO) GetTarget() LFOTarget {
+	return l.target
+}
+
+// SetRate sets a free running rate in Hz
+func (l *LFO) SetRate(hz float64) {
+	l.rate = hz
+	l.sync = 0
+}
+
+// SetSync syncs the rate to the tempo, with one cycle lasting the given
+// fraction of a whole note (0.25 is a beat, 0.0625 a row)
+func (l *LFO) SetSync(wholeNotes float64) {
+	l.sync = wholeNotes
+}
+
+// SetTempo sets the tempo in BPM used by synced rates
+func (l *LFO) SetTempo(bpm float64) {
+	if bpm > 0 {
+		l.tempo = bpm
+	}
+}
+
+// SetDepth sets the modulation depth, in the unit of the target
+func (l *LFO) SetDepth(depth float64) {
+	l.depth = depth
+}
+
+// SetDelay sets how many seconds the LFO waits after a note starts
+func (l *LFO) SetDelay(seconds float64) {
+	l.delay = seconds
+}
+
+// SetFade sets how many seconds the LFO takes to fade in after its delay
+func (l *LFO) SetFade(seconds float64) {
+	l.fade = seconds
+}
+
+// Trigger restarts the LFO cycle, delay and fade-in for a new note
+func (l *LFO) Trigger() {
+	l.phase = 0.0
+	l.elapsed = 0
+	l.held = 2.0*l.rng.Float64() - 1.0
+}
+
+// Next advances the LFO by one sample and returns its output, between
+// -depth and +depth once the delay and fade-in are over
+func (l *LFO) Next() float64 {
+	t := float64(l.elapsed) / l.sampleRate
+	l.elapsed++
+	if t < l.delay {
+		l.fadeLevel = 0.0
+		return 0.0
+	}
+	l.fadeLevel = 1.0
+	if t-l.delay < l.fade {
+		l.fadeLevel = (t - l.delay) / l.fade
+	}
+
+	var value float64
+	switch l.shape {
+	case LFOTriangle:
+		value = 1.0 - 4.0*math.Abs(l.phase-0.5)
+	case LFOSquare:
+		value = 1.0
+		if l.phase >= 0.5 {
+			value = -1.0
+		}
+	case LFOSampleHold:
+		value = l.held
+	default:
+		value = math.Sin(2.0 * math.Pi * l.phase)
+	}
+
+	rate := l.rate
+	if l.sync > 0 {
+		rate = l.tempo / (240.0 * l.sync)
+	}
+	l.phase += rate / l.sampleRate
+	if l.phase >= 1.0 {
+		l.phase -= math.Floor(l.phase)
+		l.held = 2.0*l.rng.Float64() - 1.0
+	}
+
+	return value * l.depth * l.fadeLevel
+}
+
+// tremolo turns the output of an amplitude LFO into a gain, which dips
+// from 1 down to 1-depth
+func (l *LFO) tremolo(out float64) float64 {
+	return 1.0 - (l.depth*l.fadeLevel-out)/2.0
+}
+
+// setLFOParam applies an lfo<N>.<name> parameter, adding LFOs as needed.
+// handled is false if the key is not an LFO parameter. Only the given
+// targets are accepted.
+func setLFOParam(lfos []*LFO, key, value string, sampleRate float64, targets ...LFOTarget) (_ []*LFO, handled bool, err error) {
+	lfoName, name, ok := strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(lfoName, "lfo") {
+		return lfos, false, nil
+	}
+	n, err := strconv.Atoi(lfoName[3:])
+	if err != nil || n < 1 || n > maxLFOs {
+		return lfos, true, fmt.Errorf("LFOs are numbered from 1 to %d", maxLFOs)
+	}
+	for len(lfos) < n {
+		lfos = append(lfos, NewLFO(sampleRate))
+	}
+	lfo := lfos[n-1]
+
+	switch name {
+	case "shape":
+		shape, ok := lfoShapeNames[strings.ToLower(value)]
+		if !ok {
+			return lfos, true, fmt.Errorf("expected sine, tri, square or sh")
+		}
+		lfo.SetShape(shape)
+
+	case "target":
+		target, ok := lfoTargetNames[strings.ToLower(value)]
+		if !ok || !slices.Contains(targets, target) {
+			names := make([]string, 0, len(targets))
+			for name, t := range lfoTargetNames {
+				if slices.Contains(targets, t) {
+					names = append(names, name)
+				}
+			}
+			slices.Sort(names)
+			return lfos, true, fmt.Errorf("expected one of %s", strings.Join(names, ", "))
+		}
+		lfo.SetTarget(target)
+
+	case "rate":
+		// "5" is 5Hz, "1/8" is one cycle per eighth note
+		if num, den, ok := strings.Cut(value, "/"); ok {
+			a, errA := strconv.ParseFloat(num, 64)
+			b, errB := strconv.ParseFloat(den, 64)
+			if errA != nil || errB != nil || a <= 0 || b <= 0 {
+				return lfos, true, fmt.Errorf("expected a rate in Hz or a note length like 1/8")
+			}
+			lfo.SetSync(a / b)
+		} else {
+			hz, err := strconv.ParseFloat(value, 64)
+			if err != nil || hz < 0 {
+				return lfos, true, fmt.Errorf("expected a rate in Hz or a note length like 1/8")
+			}
+			lfo.SetRate(hz)
+		}
+
+	case "depth":
+		depth, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return lfos, true, fmt.Errorf("expected a number")
+		}
+		lfo.SetDepth(depth)
+
+	case "delay", "fade":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return lfos, true, fmt.Errorf("expected a time in seconds")
+		}
+		if name == "delay" {
+			lfo.SetDelay(seconds)
+		} else {
+			lfo.SetFade(seconds)
+		}
+
+	default:
+		return lfos, true, fmt.Errorf("unknown LFO parameter %q", name)
+	}
+	return lfos, true, nil
+}
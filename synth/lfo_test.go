@@ -0,0 +1,184 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+// lfoParams builds the LFOs of an instrument from lfo1.* parameters
+func lfoParams(t *testing.T, params map[string]string) *LFO {
+	t.Helper()
+	var lfos []*LFO
+	for key, value := range params {
+		var err error
+		lfos, _, err = setLFOParam(lfos, "lfo1."+key, value, 1000, LFOPitch, LFOAmp)
+		if err != nil {
+			t.Fatalf("lfo1.%s=%s: %v", key, value, err)
+		}
+	}
+	return lfos[0]
+}
+
+// measureRate returns the rate in Hz of an LFO at a 1kHz sample rate, from
+// the square cycles it starts over 12 seconds
+func measureRate(lfo *LFO) float64 {
+	lfo.SetShape(LFOSquare)
+	lfo.SetDepth(1)
+	lfo.Trigger()
+	cycles, last := 0, -1.0
+	for range 12000 {
+		out := lfo.Next()
+		if out > 0 && last < 0 {
+			cycles++
+		}
+		last = out
+	}
+	return float64(cycles) / 12.0
+}
+
+func TestLFORate(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		tempo  float64 // 0 keeps the default of 120 BPM
+		hz     float64
+	}{
+		{"default", map[string]string{"shape": "sine"}, 0, 5},
+		{"free", map[string]string{"rate": "2"}, 0, 2},
+		{"fractional", map[string]string{"rate": "0.5"}, 0, 0.5},
+		{"quarter note", map[string]string{"rate": "1/4"}, 0, 2},
+		{"sixteenth note", map[string]string{"rate": "1/16"}, 0, 8},
+		{"dotted eighth", map[string]string{"rate": "3/16"}, 0, 8.0 / 3.0},
+		{"quarter note at 90 BPM", map[string]string{"rate": "1/4"}, 90, 1.5},
+		{"whole note at 60 BPM", map[string]string{"rate": "1/1"}, 60, 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lfo := lfoParams(t, tt.params)
+			if tt.tempo > 0 {
+				lfo.SetTempo(tt.tempo)
+			}
+			if got := measureRate(lfo); math.Abs(got-tt.hz) > 1.0/12.0 {
+				t.Errorf("rate %.3fHz, want %.3fHz", got, tt.hz)
+			}
+		})
+	}
+}
+
+func TestLFOShapes(t *testing.T) {
+	// Output at each eighth of a 1Hz cycle, with a depth of 2
+	tests := []struct {
+		shape LFOShape
+		want  []float64
+	}{
+		{LFOSine, []float64{0, math.Sqrt2, 2, math.Sqrt2, 0, -math.Sqrt2, -2, -math.Sqrt2}},
+		{LFOTriangle, []float64{-2, -1, 0, 1, 2, 1, 0, -1}},
+		{LFOSquare, []float64{2, 2, 2, 2, -2, -2, -2, -2}},
+	}
+
+	for _, tt := range tests {
+		lfo := NewLFO(1000)
+		lfo.SetShape(tt.shape)
+		lfo.SetRate(1)
+		lfo.SetDepth(2)
+		lfo.Trigger()
+		for i := range 1000 {
+			out := lfo.Next()
+			if i%125 == 0 && math.Abs(out-tt.want[i/125]) > 1e-9 {
+				t.Errorf("shape %d at %d/8 of the cycle = %.4f, want %.4f", tt.shape, i/125, out, tt.want[i/125])
+			}
+		}
+	}
+}
+
+func TestLFOSampleHold(t *testing.T) {
+	lfo := NewLFO(1000)
+	lfo.SetShape(LFOSampleHold)
+	lfo.SetRate(10)
+	lfo.SetDepth(1)
+	lfo.Trigger()
+
+	// One level per 100-sample cycle, different from cycle to cycle
+	var levels []float64
+	for i := range 1000 {
+		out := lfo.Next()
+		if math.Abs(out) > 1 {
+			t.Fatalf("sample %d = %f is beyond the depth", i, out)
+		}
+		if i%100 == 0 {
+			levels = append(levels, out)
+		} else if out != levels[len(levels)-1] {
+			t.Fatalf("sample %d = %f changed within a cycle", i, out)
+		}
+	}
+	for i := 1; i < len(levels); i++ {
+		if levels[i] == levels[i-1] {
+			t.Errorf("cycles %d and %d hold the same level", i-1, i)
+		}
+	}
+}
+
+func TestLFODelayAndFade(t *testing.T) {
+	// Square LFO so the output is the depth times the fade-in level
+	lfo := lfoParams(t, map[string]string{"shape": "square", "rate": "0.1", "depth": "1", "delay": "0.2", "fade": "0.4"})
+
+	for trigger := range 2 {
+		lfo.Trigger()
+		for i := range 1000 {
+			want := 0.0
+			switch {
+			case i >= 600:
+				want = 1.0
+			case i >= 200:
+				want = float64(i-200) / 400.0
+			}
+			if out := lfo.Next(); math.Abs(out-want) > 1e-9 {
+				t.Fatalf("note %d sample %d = %.4f, want %.4f", trigger, i, out, want)
+			}
+		}
+	}
+}
+
+func TestLFOParamErrors(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"lfo0.rate", "5"},
+		{"lfo9.rate", "5"},
+		{"lfo1.rate", "-1"},
+		{"lfo1.rate", "1/0"},
+		{"lfo1.rate", "fast"},
+		{"lfo1.shape", "saw"},
+		{"lfo1.target", "cutoff"}, // Not one of the targets given
+		{"lfo1.depth", "deep"},
+		{"lfo1.delay", "-0.1"},
+		{"lfo1.speed", "5"},
+	}
+
+	for _, tt := range tests {
+		_, handled, err := setLFOParam(nil, tt.key, tt.value, 1000, LFOPitch, LFOAmp)
+		if !handled || err == nil {
+			t.Errorf("%s=%s: handled %v, error %v, want an error", tt.key, tt.value, handled, err)
+		}
+	}
+	if _, handled, _ := setLFOParam(nil, "cutoff", "100", 1000, LFOPitch); handled {
+		t.Error("cutoff was handled as an LFO parameter")
+	}
+}
+
+func TestVoiceLFOFollowsTempo(t *testing.T) {
+	v := NewVoice(Sine, 1000)
+	err := v.ApplyParams(map[string]string{"lfo1.rate": "1/4", "lfo2.rate": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetTempo(60)
+
+	// The synced LFO runs a cycle per beat, the free one keeps its rate
+	for i, want := range []float64{1, 3} {
+		if got := measureRate(v.lfos[i]); math.Abs(got-want) > 1.0/12.0 {
+			t.Errorf("lfo%d rate %.3fHz at 60 BPM, want %.3fHz", i+1, got, want)
+		}
+	}
+}
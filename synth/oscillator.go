@@ -1,6 +1,9 @@
 package synth
 
-import "math"
+import (
+	"math"
+	"math/rand/v2"
+)
 
 // WaveType represents different oscillator waveforms
 type WaveType int
@@ -11,14 +14,51 @@ const (
 	Triangle
 	Sine
 	Noise
+
+	// Band-limited (PolyBLEP) versions of the basic waves, free of the
+	// aliasing the naive "chip" waves above have at high pitches
+	SquareBL
+	SawBL
+	TriangleBL
+
+	// Colored noise, independent of the note
+	PinkNoise  // -3dB per octave, softer than white
+	BrownNoise // -6dB per octave, a low rumble
+
+	// NES/Game Boy style noise from a 15-bit LFSR clocked at a rate that
+	// follows the note. The short mode repeats quickly and sounds metallic.
+	LFSRLong
+	LFSRShort
+
+	// Pulse waves with an adjustable duty cycle (see SetDuty), naive and
+	// band-limited
+	Pulse
+	PulseBL
 )
 
+// DefaultNoiseSeed seeds the noise generator of new oscillators, so renders
+// are reproducible
+const DefaultNoiseSeed = 0x5eed
+
+// lfsrClocksPerCycle is how many times the LFSR is clocked per cycle of the
+// note frequency
+const lfsrClocksPerCycle = 16.0
+
 // Oscillator generates audio waveforms
 type Oscillator struct {
-	waveType  WaveType
-	frequency float64
-	phase     float64
+	waveType   WaveType
+	frequency  float64
+	phase      float64
+	duty       float64 // High part of the cycle for pulse waves
 	sampleRate float64
+
+	// Noise state
+	rng       *rand.Rand
+	pink      [7]float64 // Pink noise filter state
+	brown     float64    // Brown noise integrator
+	lfsr      uint16     // LFSR register
+	lfsrOut   float64    // Current LFSR output level
+	lfsrClock float64    // Fraction of an LFSR clock accumulated
 }
 
 // NewOscillator creates a new oscillator
@@ -27,9 +67,29 @@ func NewOscillator(waveType WaveType, sampleRate float64) *Oscillator {
 		waveType:   waveType,
 		sampleRate: sampleRate,
 		phase:      0.0,
+		duty:       0.5,
+		rng:        rand.New(rand.NewPCG(DefaultNoiseSeed, 0)),
+		lfsr:       1,
+		lfsrOut:    1.0,
 	}
 }
 
+// SetDuty sets the duty cycle of pulse waves (0.5 is a square wave)
+// It is kept within 1% and 99% so the wave never falls silent
+func (o *Oscillator) SetDuty(duty float64) {
+	o.duty = math.Max(0.01, math.Min(0.99, duty))
+}
+
+// SetSeed restarts the noise generators from the given seed
+func (o *Oscillator) SetSeed(seed uint64) {
+	o.rng = rand.New(rand.NewPCG(seed, 0))
+	o.pink = [7]float64{}
+	o.brown = 0.0
+	o.lfsr = 1
+	o.lfsrOut = 1.0
+	o.lfsrClock = 0.0
+}
+
 // SetFrequency sets the oscillator frequency
 func (o *Oscillator) SetFrequency(freq float64) {
 	o.frequency = freq
@@ -57,8 +117,47 @@ func (o *Oscillator) Next() float64 {
 	case Sine:
 		sample = math.Sin(2.0 * math.Pi * o.phase)
 	case Noise:
-		// Simple white noise
-		sample = 2.0*math.Mod(o.phase*12345.6789, 1.0) - 1.0
+		sample = o.white()
+	case PinkNoise:
+		sample = o.nextPink()
+	case BrownNoise:
+		sample = o.nextBrown()
+	case LFSRLong, LFSRShort:
+		sample = o.nextLFSR()
+	case Pulse:
+		if o.phase < o.duty {
+			sample = 1.0
+		} else {
+			sample = -1.0
+		}
+	case PulseBL:
+		dt := o.frequency / o.sampleRate
+		if o.phase < o.duty {
+			sample = 1.0
+		} else {
+			sample = -1.0
+		}
+		sample += polyBLEP(o.phase, dt) - polyBLEP(math.Mod(o.phase+1.0-o.duty, 1.0), dt)
+	case SquareBL:
+		dt := o.frequency / o.sampleRate
+		if o.phase < 0.5 {
+			sample = 1.0
+		} else {
+			sample = -1.0
+		}
+		sample += polyBLEP(o.phase, dt) - polyBLEP(math.Mod(o.phase+0.5, 1.0), dt)
+	case SawBL:
+		dt := o.frequency / o.sampleRate
+		sample = 2.0*o.phase - 1.0 - polyBLEP(o.phase, dt)
+	case TriangleBL:
+		dt := o.frequency / o.sampleRate
+		if o.phase < 0.5 {
+			sample = 4.0*o.phase - 1.0
+		} else {
+			sample = 3.0 - 4.0*o.phase
+		}
+		// Round off the corners where the slope changes by 8 per cycle
+		sample += 4.0 * dt * (polyBLAMP(o.phase, dt) - polyBLAMP(math.Mod(o.phase+0.5, 1.0), dt))
 	}
 
 	// Advance phase
@@ -71,6 +170,88 @@ func (o *Oscillator) Next() float64 {
 	return sample
 }
 
+// white returns uniform white noise in [-1, 1)
+func (o *Oscillator) white() float64 {
+	return 2.0*o.rng.Float64() - 1.0
+}
+
+// nextPink filters white noise to pink (Paul Kellet's refined method)
+func (o *Oscillator) nextPink() float64 {
+	w := o.white()
+	b := &o.pink
+	b[0] = 0.99886*b[0] + w*0.0555179
+	b[1] = 0.99332*b[1] + w*0.0750759
+	b[2] = 0.96900*b[2] + w*0.1538520
+	b[3] = 0.86650*b[3] + w*0.3104856
+	b[4] = 0.55000*b[4] + w*0.5329522
+	b[5] = -0.7616*b[5] - w*0.0168980
+	sum := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + w*0.5362
+	b[6] = w * 0.115926
+	return sum * 0.11
+}
+
+// nextBrown integrates white noise with a small leak to stay centered
+func (o *Oscillator) nextBrown() float64 {
+	o.brown = (o.brown + 0.02*o.white()) / 1.02
+	return o.brown * 3.5
+}
+
+// nextLFSR clocks the LFSR at a rate set by the note frequency
+func (o *Oscillator) nextLFSR() float64 {
+	// The NES takes feedback from bit 1 (long) or bit 6 (short)
+	tap := uint16(1)
+	if o.waveType == LFSRShort {
+		tap = 6
+	}
+
+	o.lfsrClock += o.frequency * lfsrClocksPerCycle / o.sampleRate
+	for o.lfsrClock >= 1.0 {
+		o.lfsrClock -= 1.0
+		feedback := (o.lfsr ^ (o.lfsr >> tap)) & 1
+		o.lfsr = (o.lfsr >> 1) | (feedback << 14)
+		if o.lfsr&1 == 0 {
+			o.lfsrOut = 1.0
+		} else {
+			o.lfsrOut = -1.0
+		}
+	}
+	return o.lfsrOut
+}
+
+// polyBLEP returns the correction for an upward step of 2 at phase 0,
+// for a wave advancing dt of a cycle per sample
+func polyBLEP(t, dt float64) float64 {
+	if dt <= 0 {
+		return 0.0
+	}
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1.0
+	}
+	if t > 1.0-dt {
+		t = (t - 1.0) / dt
+		return t*t + t + t + 1.0
+	}
+	return 0.0
+}
+
+// polyBLAMP returns the correction for a slope increase of 2 per sample at
+// phase 0 (the integral of polyBLEP)
+func polyBLAMP(t, dt float64) float64 {
+	if dt <= 0 {
+		return 0.0
+	}
+	if t < dt {
+		t = t/dt - 1.0
+		return -t * t * t / 3.0
+	}
+	if t > 1.0-dt {
+		t = (t-1.0)/dt + 1.0
+		return t * t * t / 3.0
+	}
+	return 0.0
+}
+
 // Reset resets the oscillator phase
 func (o *Oscillator) Reset() {
 	o.phase = 0.0
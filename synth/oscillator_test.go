@@ -0,0 +1,111 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+// spectrum renders whole cycles of an oscillator and returns the level of
+// each harmonic below Nyquist, and the power of everything else, which is
+// aliasing since the frequency puts aliases between the harmonics
+func spectrum(o *Oscillator, cycles, n int) (harmonics []float64, alias float64) {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = o.Next()
+	}
+
+	var total, mean float64
+	for _, s := range samples {
+		mean += s / float64(n)
+	}
+	for _, s := range samples {
+		total += (s - mean) * (s - mean) / float64(n)
+	}
+
+	alias = total
+	for k := 1; 2*k*cycles < n; k++ {
+		var re, im float64
+		for i, s := range samples {
+			angle := 2.0 * math.Pi * float64(k*cycles*i) / float64(n)
+			re += s * math.Cos(angle)
+			im += s * math.Sin(angle)
+		}
+		level := 2.0 * math.Hypot(re, im) / float64(n)
+		harmonics = append(harmonics, level)
+		alias -= level * level / 2.0
+	}
+	return harmonics, alias / total
+}
+
+func TestPolyBLEPAliasing(t *testing.T) {
+	// 249 cycles over 4410 samples is about 2.5kHz at 44.1kHz
+	const cycles, n = 249, 4410
+	freq := 44100.0 * cycles / n
+
+	tests := []struct {
+		name        string
+		naive, bl   WaveType
+		fundamental float64 // Level of the first harmonic
+		maxAlias    float64 // Largest BL alias power as a share of the naive one
+	}{
+		{"square", Square, SquareBL, 4.0 / math.Pi, 0.1},
+		{"saw", Saw, SawBL, 2.0 / math.Pi, 0.1},
+		{"triangle", Triangle, TriangleBL, 8.0 / (math.Pi * math.Pi), 0.2},
+		{"pulse", Pulse, PulseBL, 4.0 / math.Pi * math.Sin(math.Pi*0.25), 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var alias [2]float64
+			for i, wave := range []WaveType{tt.naive, tt.bl} {
+				o := NewOscillator(wave, 44100)
+				o.SetFrequency(freq)
+				o.SetDuty(0.25) // Only used by the pulse waves
+				harmonics, a := spectrum(o, cycles, n)
+				alias[i] = a
+				if math.Abs(harmonics[0]-tt.fundamental) > 0.02*tt.fundamental {
+					t.Errorf("wave %d: fundamental level %.4f, want %.4f", wave, harmonics[0], tt.fundamental)
+				}
+			}
+			t.Logf("alias power: naive %.2e, band-limited %.2e", alias[0], alias[1])
+			if alias[1] > alias[0]*tt.maxAlias {
+				t.Errorf("band-limited alias power %.2e is not under %.0f%% of the naive %.2e",
+					alias[1], 100*tt.maxAlias, alias[0])
+			}
+		})
+	}
+}
+
+// highFraction returns the share of n samples from next that are above zero
+func highFraction(next func() float64, n int) float64 {
+	high := 0
+	for range n {
+		if next() > 0 {
+			high++
+		}
+	}
+	return float64(high) / float64(n)
+}
+
+func TestPulseDuty(t *testing.T) {
+	tests := []struct {
+		duty, want float64
+	}{
+		{0.5, 0.5},
+		{0.25, 0.25},
+		{0.125, 0.125},
+		{0.75, 0.75},
+		{0.0, 0.01}, // Kept audible
+		{1.0, 0.99},
+	}
+
+	for _, tt := range tests {
+		// 10Hz at 10kHz gives whole cycles of 1000 samples
+		o := NewOscillator(Pulse, 10000)
+		o.SetFrequency(10)
+		o.SetDuty(tt.duty)
+		if got := highFraction(o.Next, 10000); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("duty %.3f: high for %.4f of the cycle, want %.4f", tt.duty, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package synth
+
+import (
+	"math"
+	"strings"
+)
+
+// SampleMode selects how a sample voice plays its sample
+type SampleMode int
+
+const (
+	SampleForward  SampleMode = iota // Repeat the loop if there is one, else play once
+	SamplePingPong                   // Play the loop back and forth
+	SampleOneShot                    // Play the whole sample once, ignoring the loop and note-offs
+)
+
+// sampleModeNames are the names used by the "mode" instrument parameter
+var sampleModeNames = map[string]SampleMode{
+	"forward":  SampleForward,
+	"pingpong": SamplePingPong,
+	"oneshot":  SampleOneShot,
+}
+
+// ParseSampleMode returns the sample mode for a name like "pingpong"
+func ParseSampleMode(name string) (SampleMode, bool) {
+	mode, ok := sampleModeNames[strings.ToLower(name)]
+	return mode, ok
+}
+
+// Sample is recorded audio for sample instruments, mixed down to mono
+// The base note, loop and mode are defaults that instrument parameters
+// can override.
+type Sample struct {
+	Data       []float64 // Frames from -1.0 to 1.0
+	SampleRate float64
+	BaseNote   int // Note at which the sample plays at its recorded pitch
+	LoopStart  int // First frame of the loop
+	LoopEnd    int // Frame after the end of the loop (0 for no loop)
+	Mode       SampleMode
+}
+
+// NewSample creates a sample from the samples of each channel, averaging
+// them to mono, with C-4 as the base note and no loop
+func NewSample(channels [][]float64, sampleRate float64) *Sample {
+	s := &Sample{SampleRate: sampleRate, BaseNote: 48}
+	if len(channels) == 0 {
+		return s
+	}
+	s.Data = make([]float64, len(channels[0]))
+	for _, samples := range channels {
+		for i := range s.Data {
+			s.Data[i] += samples[i] / float64(len(channels))
+		}
+	}
+	return s
+}
+
+// SamplePlayer plays a Sample at any pitch, resampling it with cubic
+// interpolation
+type SamplePlayer struct {
+	sample     *Sample
+	sampleRate float64 // Output sample rate
+	baseNote   int     // Note at which the sample plays at its recorded pitch
+	loopStart  int
+	loopEnd    int
+	mode       SampleMode
+
+	position float64 // Frames into the sample
+	speed    float64 // Frames per output sample
+	reverse  bool    // Playing backwards through a ping-pong loop
+	done     bool
+}
+
+// NewSamplePlayer creates a player for a sample, with the sample's base
+// note, loop and mode
+func NewSamplePlayer(sample *Sample, sampleRate float64) *SamplePlayer {
+	return &SamplePlayer{
+		sample:     sample,
+		sampleRate: sampleRate,
+		baseNote:   sample.BaseNote,
+		loopStart:  sample.LoopStart,
+		loopEnd:    sample.LoopEnd,
+		mode:       sample.Mode,
+		done:       true,
+	}
+}
+
+// SetBaseNote sets the note at which the sample plays at its recorded pitch
+func (p *SamplePlayer) SetBaseNote(note int) {
+	p.baseNote = note
+}
+
+// SetLoop sets the loop in frames, end excluded (end 0 for no loop)
+func (p *SamplePlayer) SetLoop(start, end int) {
+	p.loopStart, p.loopEnd = start, end
+}
+
+// SetMode sets how the sample is played
+func (p *SamplePlayer) SetMode(mode SampleMode) {
+	p.mode = mode
+}
+
+// GetMode returns how the sample is played
+func (p *SamplePlayer) GetMode() SampleMode {
+	return p.mode
+}
+
+// SetFrequency sets the pitch, relative to the base note
+func (p *SamplePlayer) SetFrequency(freq float64) {
+	p.speed = freq / NoteToFrequency(p.baseNote) * p.sample.SampleRate / p.sampleRate
+}
+
+// Trigger starts playing from the beginning of the sample
+func (p *SamplePlayer) Trigger() {
+	p.position = 0.0
+	p.reverse = false
+	p.done = len(p.sample.Data) == 0
+}
+
+// Done returns true once a sample without a loop has played to its end
+func (p *SamplePlayer) Done() bool {
+	return p.done
+}
+
+// looping returns true if the loop is repeated
+func (p *SamplePlayer) looping() bool {
+	return p.mode != SampleOneShot && p.loopStart >= 0 &&
+		p.loopEnd > p.loopStart && p.loopEnd <= len(p.sample.Data)
+}
+
+// Next returns the next sample
+func (p *SamplePlayer) Next() float64 {
+	if p.done {
+		return 0.0
+	}
+	out := p.interpolate()
+
+	if !p.looping() {
+		p.position += p.speed
+		if p.position >= float64(len(p.sample.Data)) {
+			p.done = true
+		}
+		return out
+	}
+
+	start, end := float64(p.loopStart), float64(p.loopEnd)
+	if p.mode == SamplePingPong && end-start > 1.0 {
+		// Bounce between the first and last frames of the loop
+		last := end - 1.0
+		if p.reverse {
+			p.position -= p.speed
+		} else {
+			p.position += p.speed
+		}
+		for {
+			if !p.reverse && p.position > last {
+				p.position = 2.0*last - p.position
+				p.reverse = true
+			} else if p.reverse && p.position < start {
+				p.position = 2.0*start - p.position
+				p.reverse = false
+			} else {
+				break
+			}
+		}
+		return out
+	}
+
+	p.position += p.speed
+	if p.position >= end {
+		p.position = start + math.Mod(p.position-start, end-start)
+	}
+	return out
+}
+
+// interpolate returns the sample at the current position, using 4-point
+// Hermite interpolation between frames
+func (p *SamplePlayer) interpolate() float64 {
+	i := int(p.position)
+	t := p.position - float64(i)
+	x0, x1, x2, x3 := p.frame(i-1), p.frame(i), p.frame(i+1), p.frame(i+2)
+
+	c1 := 0.5 * (x2 - x0)
+	c2 := x0 - 2.5*x1 + 2.0*x2 - 0.5*x3
+	c3 := 0.5*(x3-x0) + 1.5*(x1-x2)
+	return ((c3*t+c2)*t+c1)*t + x1
+}
+
+// frame returns frame i, continuing forward loops seamlessly and reading
+// silence outside the sample
+func (p *SamplePlayer) frame(i int) float64 {
+	if p.mode == SampleForward && p.looping() && i >= p.loopEnd {
+		i = p.loopStart + (i-p.loopEnd)%(p.loopEnd-p.loopStart)
+	}
+	if i < 0 || i >= len(p.sample.Data) {
+		return 0.0
+	}
+	return p.sample.Data[i]
+}
@@ -1,29 +1,75 @@
 package synth
 
-// Voice represents a single synthesis voice (oscillator + envelope OR FM instrument)
+import "math"
+
+// Voice represents a single synthesis voice (oscillator or sample + envelope OR FM instrument)
 type Voice struct {
 	// Traditional synthesis
 	oscillator *Oscillator
 	envelope   *Envelope
-	
+
+	// Sample playback, replacing the oscillator (nil for oscillator voices)
+	sampler *SamplePlayer
+
 	// FM synthesis
 	fmInstrument *FMInstrument
 	useFM        bool
-	
+
 	volume     float64
 	active     bool
 	sampleRate float64
+
+	// Pulse width and its modulation (PULSE waves)
+	pulseWidth      float64
+	instrumentWidth float64 // Width set by the instrument parameters
+	pwmRate         float64 // LFO rate in Hz
+	pwmDepth        float64 // LFO depth in pulse width units
+	pwmPhase        float64
+
+	// Resonant filter with its own envelope (nil when the instrument has none)
+	filter           *Filter
+	filterEnv        *Envelope
+	filterCutoff     float64 // Base cutoff in Hz
+	instrumentCutoff float64 // Cutoff set by the instrument parameters
+	filterResonance  float64
+	keyTracking      float64 // 0 keeps the cutoff fixed, 1 follows the note fully
+	filterEnvAmount  float64 // Octaves the filter envelope opens the cutoff by
+
+	legato    bool    // Envelopes keep running when a held note is retriggered
+	frequency float64 // Note frequency before LFO pitch modulation
+	lfos      []*LFO
 }
 
+// keyTrackingCenter is the note frequency (C-4) at which key tracking
+// leaves the cutoff unchanged
+var keyTrackingCenter = NoteToFrequency(48)
+
 // NewVoice creates a new synthesis voice with traditional oscillator
 func NewVoice(waveType WaveType, sampleRate float64) *Voice {
 	return &Voice{
 		oscillator: NewOscillator(waveType, sampleRate),
 		envelope:   NewEnvelope(0.01, 0.1, 0.6, 0.2, sampleRate),
 		volume:     1.0,
-		active:     false,
-		useFM:      false,
-		sampleRate: sampleRate,
+		pulseWidth: 0.5,
+
+		instrumentWidth: 0.5,
+		active:          false,
+		useFM:           false,
+		sampleRate:      sampleRate,
+	}
+}
+
+// NewSampleVoice creates a new voice playing a sample instead of an
+// oscillator, with an envelope that only shapes the release
+func NewSampleVoice(sample *Sample, sampleRate float64) *Voice {
+	return &Voice{
+		sampler:    NewSamplePlayer(sample, sampleRate),
+		envelope:   NewEnvelope(0.0, 0.0, 1.0, 0.05, sampleRate),
+		volume:     1.0,
+		pulseWidth: 0.5,
+
+		instrumentWidth: 0.5,
+		sampleRate:      sampleRate,
 	}
 }
 
@@ -53,7 +99,9 @@ func (v *Voice) SetInstrument(waveType WaveType, attack, decay, sustain, release
 	if v.useFM {
 		return // Can't change FM instrument parameters this way
 	}
-	v.oscillator.waveType = waveType
+	if v.oscillator != nil {
+		v.oscillator.waveType = waveType
+	}
 	v.envelope.attackTime = attack
 	v.envelope.decayTime = decay
 	v.envelope.sustainLevel = sustain
@@ -70,22 +118,132 @@ func (v *Voice) SetFMInstrument(fmInstrument *FMInstrument) {
 func (v *Voice) NoteOn(note int, volume float64) {
 	v.volume = volume
 	v.active = true
-	
+	v.frequency = NoteToFrequency(note)
+
 	if v.useFM && v.fmInstrument != nil {
 		v.fmInstrument.NoteOn(note, volume)
 	} else {
-		freq := NoteToFrequency(note)
-		v.oscillator.SetFrequency(freq)
+		v.setPitch(v.frequency)
+		if v.legato && v.envelope.isHeld() {
+			return // Legato: only the pitch changes
+		}
+		v.pwmPhase = 0.0
+		if v.sampler != nil {
+			v.sampler.Trigger()
+		} else {
+			v.oscillator.SetDuty(v.pulseWidth)
+		}
 		v.envelope.Trigger()
+		if v.filterEnv != nil {
+			v.filterEnv.Trigger()
+		}
+		for _, lfo := range v.lfos {
+			lfo.Trigger()
+		}
+	}
+}
+
+// SetFrequency changes the pitch of the sounding note without retriggering it
+func (v *Voice) SetFrequency(freq float64) {
+	v.frequency = freq
+	if v.useFM && v.fmInstrument != nil {
+		v.fmInstrument.SetFrequency(freq)
+	} else {
+		v.setPitch(freq)
+	}
+}
+
+// GetFrequency returns the frequency of the note in Hz, before LFO pitch
+// modulation
+func (v *Voice) GetFrequency() float64 {
+	return v.frequency
+}
+
+// setPitch sets the frequency of the oscillator or sample
+func (v *Voice) setPitch(freq float64) {
+	if v.sampler != nil {
+		v.sampler.SetFrequency(freq)
+	} else {
+		v.oscillator.SetFrequency(freq)
+	}
+}
+
+// SetVolume changes the volume of the sounding note without retriggering it
+func (v *Voice) SetVolume(volume float64) {
+	v.volume = volume
+	if v.useFM && v.fmInstrument != nil {
+		v.fmInstrument.SetVolume(volume)
+	}
+}
+
+// GetVolume returns the volume of the note, before the envelope
+func (v *Voice) GetVolume() float64 {
+	return v.volume
+}
+
+// SetPulseWidth sets the duty cycle of PULSE waves (0.5 is a square wave)
+// A width of 0 restores the instrument's width. PWM from the instrument
+// keeps modulating around the new width.
+func (v *Voice) SetPulseWidth(width float64) {
+	if width <= 0 {
+		width = v.instrumentWidth
+	}
+	v.pulseWidth = width
+	if v.oscillator != nil {
+		v.oscillator.SetDuty(width)
+	}
+}
+
+// SetTempo sets the tempo in BPM for LFOs synced to it
+func (v *Voice) SetTempo(bpm float64) {
+	if v.useFM && v.fmInstrument != nil {
+		v.fmInstrument.SetTempo(bpm)
+		return
+	}
+	for _, lfo := range v.lfos {
+		lfo.SetTempo(bpm)
+	}
+}
+
+// SetSeed restarts the noise generator of the voice from the given seed
+// Voices sounding together need different seeds for their noise to be
+// independent. Sample and FM voices ignore it.
+func (v *Voice) SetSeed(seed uint64) {
+	if v.oscillator != nil {
+		v.oscillator.SetSeed(seed)
+	}
+}
+
+// SetFilterCutoff sets the base cutoff of the instrument filter in Hz
+// A cutoff of 0 restores the instrument's cutoff. Voices without a filter
+// ignore it.
+func (v *Voice) SetFilterCutoff(cutoff float64) {
+	if cutoff <= 0 {
+		cutoff = v.instrumentCutoff
+	}
+	v.filterCutoff = cutoff
+}
+
+// GetFilterCutoff returns the base cutoff of the filter in Hz, or 0 if the
+// voice has no filter
+func (v *Voice) GetFilterCutoff() float64 {
+	if v.filter == nil {
+		return 0.0
 	}
+	return v.filterCutoff
 }
 
 // NoteOff releases the note
 func (v *Voice) NoteOff() {
 	if v.useFM && v.fmInstrument != nil {
 		v.fmInstrument.NoteOff()
+	} else if v.sampler != nil && v.sampler.GetMode() == SampleOneShot {
+		return // One-shot samples play to their end
 	} else {
 		v.envelope.Release()
+		if v.filterEnv != nil {
+			v.filterEnv.Release()
+		}
 	}
 }
 
@@ -96,13 +254,13 @@ func (v *Voice) Next() float64 {
 		if !v.active && !v.fmInstrument.IsActive() {
 			return 0.0
 		}
-		
+
 		sample := v.fmInstrument.Next()
-		
+
 		if !v.fmInstrument.IsActive() {
 			v.active = false
 		}
-		
+
 		return sample
 	} else {
 		// Traditional synthesis path
@@ -110,14 +268,64 @@ func (v *Voice) Next() float64 {
 			return 0.0
 		}
 
-		osc := v.oscillator.Next()
+		// LFO modulation
+		pitch, gain, width, cutoffShift := 0.0, 1.0, 0.0, 0.0
+		for _, lfo := range v.lfos {
+			out := lfo.Next()
+			switch lfo.target {
+			case LFOPitch:
+				pitch += out
+			case LFOAmp:
+				gain *= lfo.tremolo(out)
+			case LFOPulseWidth:
+				width += out
+			case LFOCutoff:
+				cutoffShift += out
+			}
+		}
+		if pitch != 0 {
+			v.setPitch(v.frequency * math.Exp2(pitch/12.0))
+		} else if len(v.lfos) > 0 {
+			v.setPitch(v.frequency)
+		}
+
+		if v.pwmDepth != 0 {
+			width += v.pwmDepth * math.Sin(2.0*math.Pi*v.pwmPhase)
+			v.pwmPhase += v.pwmRate / v.sampleRate
+			v.pwmPhase -= math.Floor(v.pwmPhase)
+		}
+		if (width != 0 || v.pwmDepth != 0) && v.oscillator != nil {
+			v.oscillator.SetDuty(v.pulseWidth + width)
+		}
+
+		var osc float64
+		if v.sampler != nil {
+			osc = v.sampler.Next()
+			if v.sampler.Done() {
+				v.envelope.Reset() // Nothing left to play
+			}
+		} else {
+			osc = v.oscillator.Next()
+		}
 		env := v.envelope.Next()
 
+		if v.filter != nil {
+			cutoff := v.filterCutoff * math.Exp2(cutoffShift)
+			if v.keyTracking != 0 {
+				cutoff *= math.Pow(v.frequency/keyTrackingCenter, v.keyTracking)
+			}
+			if v.filterEnvAmount != 0 {
+				cutoff *= math.Exp2(v.filterEnvAmount * v.filterEnv.Next())
+			}
+			v.filter.Set(cutoff, v.filterResonance)
+			osc = v.filter.Process(osc)
+		}
+
 		if !v.envelope.IsActive() {
 			v.active = false
 		}
 
-		return osc * env * v.volume
+		return osc * env * v.volume * gain
 	}
 }
 
@@ -0,0 +1,252 @@
+package synth
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParamError reports an instrument parameter that could not be applied
+type ParamError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s=%s: %v", e.Key, e.Value, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyParams applies key=value parameters as written on INSTRUMENT and
+// SAMPLE lines:
+//
+//	adsr=0.01,0.1,0.6,0.2    envelope attack, decay, sustain and release
+//	curve=exp                envelope curve: linear, exp or a curvature like 3 or -2
+//	delay=0.1                seconds before the attack starts
+//	hold=0.05                seconds full level is held after the attack
+//	legato=1                 new notes glide without restarting a held envelope
+//	width=0.25               pulse width of PULSE waves (default 0.5)
+//	pwm=2,0.2                pulse width modulation: LFO rate in Hz and depth
+//	filter=lp                filter mode: lp, hp, bp, notch or off
+//	cutoff=800               filter cutoff in Hz
+//	res=0.7                  filter resonance (0 to 1)
+//	keytrack=0.5             how much the cutoff follows the note (0 to 1)
+//	fenv=0.001,0.2,0.3,0.1   filter envelope ADSR
+//	fenvamt=3                octaves the filter envelope opens the cutoff by
+//	lfo1.target=pitch        LFO target: pitch, amp, pw or cutoff
+//	lfo1.shape=sine          LFO shape: sine, tri, square or sh (sample and hold)
+//	lfo1.rate=5              LFO rate in Hz, or a note length like 1/8 to sync to the tempo
+//	lfo1.depth=0.3           semitones, volume fraction, pulse width or octaves
+//	lfo1.delay=0.2           seconds after the note starts before the LFO starts
+//	lfo1.fade=0.5            seconds for the LFO to fade in
+//	base=C-4                 note at which a sample plays at its recorded pitch
+//	loop=1200,4800           sample loop in frames, end excluded (off for none)
+//	mode=pingpong            sample playback: forward, pingpong or oneshot
+//
+// Any filter parameter without "filter" gives a low-pass filter, and an
+// instrument can have up to 8 LFOs (lfo1 to lfo8).
+// Invalid parameters are skipped; the returned error joins one ParamError
+// for each of them.
+func (v *Voice) ApplyParams(params map[string]string) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		if err := v.setParam(key, params[key]); err != nil {
+			errs = append(errs, &ParamError{Key: key, Value: params[key], Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (v *Voice) setParam(key, value string) error {
+	lfos, handled, err := setLFOParam(v.lfos, key, value, v.sampleRate,
+		LFOPitch, LFOAmp, LFOPulseWidth, LFOCutoff)
+	v.lfos = lfos
+	if handled {
+		return err
+	}
+
+	switch key {
+	case "adsr":
+		adsr, err := parseFloats(value, 4)
+		if err != nil {
+			return err
+		}
+		v.envelope.SetADSR(adsr[0], adsr[1], adsr[2], adsr[3])
+
+	case "base", "loop", "mode":
+		if v.sampler == nil {
+			return fmt.Errorf("only for SAMPLE instruments")
+		}
+		return v.setSampleParam(key, value)
+
+	case "curve":
+		curve, err := parseCurve(value)
+		if err != nil {
+			return err
+		}
+		v.envelope.SetCurve(curve)
+
+	case "delay", "hold":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("expected a time in seconds")
+		}
+		if key == "delay" {
+			v.envelope.SetDelay(seconds)
+		} else {
+			v.envelope.SetHold(seconds)
+		}
+
+	case "legato":
+		legato, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected 0 or 1")
+		}
+		v.legato = legato
+		v.envelope.SetLegato(legato)
+		if v.filterEnv != nil {
+			v.filterEnv.SetLegato(legato)
+		}
+
+	case "width":
+		width, err := strconv.ParseFloat(value, 64)
+		if err != nil || width <= 0 || width >= 1 {
+			return fmt.Errorf("expected a number between 0 and 1")
+		}
+		v.instrumentWidth = width
+		v.SetPulseWidth(width)
+
+	case "pwm":
+		pwm, err := parseFloats(value, 2)
+		if err != nil {
+			return err
+		}
+		if pwm[0] < 0 || pwm[1] < 0 || pwm[1] >= 0.5 {
+			return fmt.Errorf("expected a rate of at least 0 and a depth from 0 to 0.5")
+		}
+		v.pwmRate, v.pwmDepth = pwm[0], pwm[1]
+
+	case "filter":
+		mode, ok := ParseFilterMode(value)
+		if !ok {
+			return fmt.Errorf("expected lp, hp, bp, notch or off")
+		}
+		v.ensureFilter().SetMode(mode)
+
+	case "cutoff":
+		cutoff, err := strconv.ParseFloat(value, 64)
+		if err != nil || cutoff <= 0 {
+			return fmt.Errorf("expected a positive frequency")
+		}
+		v.ensureFilter()
+		v.instrumentCutoff = cutoff
+		v.filterCutoff = cutoff
+
+	case "res":
+		res, err := strconv.ParseFloat(value, 64)
+		if err != nil || res < 0 || res > 1 {
+			return fmt.Errorf("expected a number between 0 and 1")
+		}
+		v.ensureFilter()
+		v.filterResonance = res
+
+	case "keytrack":
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 || amount > 1 {
+			return fmt.Errorf("expected a number between 0 and 1")
+		}
+		v.ensureFilter()
+		v.keyTracking = amount
+
+	case "fenv":
+		adsr, err := parseFloats(value, 4)
+		if err != nil {
+			return err
+		}
+		v.ensureFilter()
+		v.filterEnv.SetADSR(adsr[0], adsr[1], adsr[2], adsr[3])
+
+	case "fenvamt":
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number of octaves")
+		}
+		v.ensureFilter()
+		v.filterEnvAmount = amount
+
+	default:
+		return fmt.Errorf("unknown parameter")
+	}
+	return nil
+}
+
+// setSampleParam applies a parameter of sample voices
+func (v *Voice) setSampleParam(key, value string) error {
+	switch key {
+	case "base":
+		note := ParseNote(strings.ToUpper(value))
+		if len(value) != 3 || (value[1] != '-' && value[1] != '#') || note < 0 {
+			return fmt.Errorf("expected a note like C-4")
+		}
+		v.sampler.SetBaseNote(note)
+
+	case "loop":
+		if strings.ToLower(value) == "off" {
+			v.sampler.SetLoop(0, 0)
+			return nil
+		}
+		start, end, ok := strings.Cut(value, ",")
+		a, errA := strconv.Atoi(start)
+		b, errB := strconv.Atoi(end)
+		if !ok || errA != nil || errB != nil || a < 0 || b <= a {
+			return fmt.Errorf("expected a start and end frame like 1200,4800")
+		}
+		if b > len(v.sampler.sample.Data) {
+			return fmt.Errorf("the sample has only %d frames", len(v.sampler.sample.Data))
+		}
+		v.sampler.SetLoop(a, b)
+
+	case "mode":
+		mode, ok := ParseSampleMode(value)
+		if !ok {
+			return fmt.Errorf("expected forward, pingpong or oneshot")
+		}
+		v.sampler.SetMode(mode)
+	}
+	return nil
+}
+
+// ensureFilter adds a low-pass filter to the voice if it has none
+func (v *Voice) ensureFilter() *Filter {
+	if v.filter == nil {
+		v.filter = NewFilter(LowPass, v.sampleRate)
+		v.filterEnv = NewEnvelope(0.01, 0.1, 0.6, 0.2, v.sampleRate)
+		v.filterEnv.SetLegato(v.legato)
+		v.instrumentCutoff = 20000.0
+		v.filterCutoff = 20000.0
+	}
+	return v.filter
+}
+
+// parseCurve parses an envelope curve: "linear", "exp" or a curvature
+func parseCurve(value string) (EnvelopeCurve, error) {
+	switch strings.ToLower(value) {
+	case "linear", "lin":
+		return CurveLinear, nil
+	case "exp":
+		return CurveExponential, nil
+	}
+	k, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(k) || math.IsInf(k, 0) {
+		return 0, fmt.Errorf("expected linear, exp or a curvature")
+	}
+	return EnvelopeCurve(k), nil
+}
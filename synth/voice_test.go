@@ -0,0 +1,67 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+// pulseVoice returns a PULSE voice holding a note at full level
+func pulseVoice(t *testing.T, params map[string]string, freq float64) *Voice {
+	t.Helper()
+	v := NewVoice(Pulse, 10000)
+	v.SetInstrument(Pulse, 0, 0, 1.0, 0.1)
+	if err := v.ApplyParams(params); err != nil {
+		t.Fatalf("ApplyParams: %v", err)
+	}
+	v.NoteOn(0, 1.0)
+	v.SetFrequency(freq)
+	v.Next() // The attack starts from silence
+	return v
+}
+
+func TestVoicePulseWidth(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		widths []float64 // Passed to SetPulseWidth in turn
+		want   float64
+	}{
+		{"square by default", nil, nil, 0.5},
+		{"instrument width", map[string]string{"width": "0.25"}, nil, 0.25},
+		{"set width", map[string]string{"width": "0.25"}, []float64{0.125}, 0.125},
+		{"zero restores the instrument's", map[string]string{"width": "0.75"}, []float64{0.1, 0}, 0.75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := pulseVoice(t, tt.params, 10)
+			for _, width := range tt.widths {
+				v.SetPulseWidth(width)
+			}
+			if got := highFraction(v.Next, 10000); math.Abs(got-tt.want) > 0.002 {
+				t.Errorf("high for %.4f of the cycle, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoicePWM(t *testing.T) {
+	// pwm=1,0.2 sweeps the width from 0.3 to 0.7 and back once a second
+	v := pulseVoice(t, map[string]string{"pwm": "1,0.2"}, 100)
+
+	var widths []float64
+	for range 100 {
+		widths = append(widths, highFraction(v.Next, 100))
+	}
+	lowest, highest := widths[0], widths[0]
+	for _, w := range widths {
+		lowest, highest = math.Min(lowest, w), math.Max(highest, w)
+	}
+	if math.Abs(lowest-0.3) > 0.02 || math.Abs(highest-0.7) > 0.02 {
+		t.Errorf("width swept from %.2f to %.2f, want 0.30 to 0.70", lowest, highest)
+	}
+	// The first quarter second widens the pulse, the next half narrows it
+	if widths[20] <= widths[5] || widths[70] >= widths[30] {
+		t.Errorf("widths %.2f, %.2f, %.2f, %.2f do not follow the sine", widths[5], widths[20], widths[30], widths[70])
+	}
+}
@@ -0,0 +1,76 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells whether a diagnostic prevents a module from playing as written
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ParseError describes a problem found while parsing a VTM file
+type ParseError struct {
+	File     string
+	Line     int // 1-based line number
+	Column   int // 1-based column of the offending field (0 if the whole line)
+	Message  string
+	Severity Severity
+}
+
+// Error formats the diagnostic as "file:line:column: severity: message"
+func (e ParseError) Error() string {
+	pos := fmt.Sprintf("%s:%d", e.File, e.Line)
+	if e.Column > 0 {
+		pos += fmt.Sprintf(":%d", e.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, e.Severity, e.Message)
+}
+
+// ParseErrors is a list of diagnostics, one per line when printed
+type ParseErrors []ParseError
+
+func (l ParseErrors) Error() string {
+	lines := make([]string, len(l))
+	for i, e := range l {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Errors returns only the diagnostics with SeverityError
+func (l ParseErrors) Errors() ParseErrors {
+	var errs ParseErrors
+	for _, e := range l {
+		if e.Severity == SeverityError {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// Warnings returns only the diagnostics with SeverityWarning
+func (l ParseErrors) Warnings() ParseErrors {
+	var warnings ParseErrors
+	for _, e := range l {
+		if e.Severity == SeverityWarning {
+			warnings = append(warnings, e)
+		}
+	}
+	return warnings
+}
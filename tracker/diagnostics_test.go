@@ -0,0 +1,146 @@
+package tracker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "valid module",
+			src:  "TEMPO 120\nINSTRUMENT Lead SQUARE 0.01 0.1 0.6 0.2\nPATTERN 1 1\nCH 0: C-4\nENDPATTERN\nSEQUENCE 0\n",
+			want: nil,
+		},
+		{
+			name: "header values",
+			src:  "TEMPO fast\nTICKS 0\n",
+			want: []string{
+				`x.vtm:1:7: error: invalid tempo "fast"`,
+				`x.vtm:2:7: error: tick count must be positive`,
+			},
+		},
+		{
+			name: "instruments",
+			src:  "BOGUS 1\nINSTRUMENT Lead WOBBLE 0.01 0.1 0.6 0.2\nINSTRUMENT Pulse PULSE 0.01 0.1 0.6 0.2 width=2\n",
+			want: []string{
+				`x.vtm:1:1: error: unknown command "BOGUS"`,
+				`x.vtm:2:17: warning: unknown wave type "WOBBLE", using SQUARE`,
+				`x.vtm:3:41: error: width=2: expected a number between 0 and 1`,
+			},
+		},
+		{
+			name: "pattern contents",
+			src:  "PATTERN 2 1\nCH 0: C-4 H-4 C-4\nCH 3: C-4\nENDPATTERN\nSEQUENCE 0 5\n",
+			want: []string{
+				`x.vtm:2:11: error: invalid note "H-4"`,
+				`x.vtm:2:15: warning: 3 rows given, pattern has 2`,
+				`x.vtm:3:4: error: channel 3 out of range (pattern has 1 channels)`,
+				`x.vtm:5:12: warning: sequence refers to missing pattern 5`,
+			},
+		},
+		{
+			name: "negative numbers",
+			src:  "PATTERN 2 1\nCH -1: C-4 E-4\nCH 0: C-4\nENDPATTERN\nSEQUENCE 0 -1 0\n",
+			want: []string{
+				`x.vtm:2:4: error: channel -1 out of range (pattern has 1 channels)`,
+				`x.vtm:5:12: error: pattern number must not be negative`,
+			},
+		},
+		{
+			name: "volume column",
+			src:  "PATTERN 2 1\nCH 0: C-4v00 C-4v65\nENDPATTERN\n",
+			want: []string{
+				`x.vtm:2:14: error: invalid volume "65" (expected 00 to 64)`,
+			},
+		},
+		{
+			name: "instrument column",
+			src:  "INSTRUMENT Lead SINE 0.01 0.1 0.6 0.2\nPATTERN 2 1\nCH 0: 01 C-4 07\nV1: C-4i01 02 E-4:037 01\nENDPATTERN\n",
+			want: []string{
+				`x.vtm:3:7: error: invalid note "01"`,
+				`x.vtm:3:10: warning: note refers to missing instrument 7`,
+				`x.vtm:4:12: error: invalid note "02"`,
+				`x.vtm:4:15: warning: 3 rows given, pattern has 2`,
+			},
+		},
+		{
+			name: "unterminated pattern",
+			src:  "PATTERN 2 1\nCH 0: C-4i07 ---\n",
+			want: []string{
+				`x.vtm:1: error: PATTERN is missing ENDPATTERN and was ignored`,
+				`x.vtm:2:7: warning: note refers to missing instrument 7`,
+			},
+		},
+		{
+			name: "layout directives",
+			src:  "FMINSTRUMENT K PIANO op9.ratio=2\nCHANNELS 1\nPATTERN 1 2\nCH 1: C-4\nENDPATTERN\n",
+			want: []string{
+				`x.vtm:1:22: error: op9.ratio=2: instrument has 4 operators`,
+				`x.vtm:4:4: warning: channel 1 is not played (CHANNELS 1 on line 2)`,
+			},
+		},
+		{
+			name: "size limits",
+			src:  "CHANNELS 65\nPOLYPHONY 2000000\nPAN 64 0.5\nPATTERN 5000 100\nV2000000: C-4\nV31: C-4\nENDPATTERN\n",
+			want: []string{
+				`x.vtm:1:10: error: channel count 65 is more than the maximum of 64`,
+				`x.vtm:2:11: error: voice count 2000000 is more than the maximum of 32`,
+				`x.vtm:3:5: error: channel 64 out of range (at most 64 channels)`,
+				`x.vtm:4:9: error: row count 5000 is more than the maximum of 1024`,
+				`x.vtm:4:14: error: channel count 100 is more than the maximum of 64`,
+				`x.vtm:5:1: error: voice 2000000 out of range (at most 32 voices)`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags, err := parseVTM(strings.NewReader(tt.src), "x.vtm", nil)
+			if err != nil {
+				t.Fatalf("parseVTM: %v", err)
+			}
+			var got []string
+			for _, d := range diags {
+				got = append(got, d.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoadVTMStrict(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "song.vtm")
+	src := "TEMPO 0\nINSTRUMENT Lead WOBBLE 0.01 0.1 0.6 0.2\nPATTERN 1 1\nCH 0: C-4\nENDPATTERN\nSEQUENCE 0\n"
+	if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	module, diags, err := LoadVTMStrict(name)
+	if module == nil {
+		t.Fatal("LoadVTMStrict returned no module")
+	}
+	if len(diags) != 2 || len(diags.Errors()) != 1 || len(diags.Warnings()) != 1 {
+		t.Fatalf("diags = %v, want one error and one warning", diags)
+	}
+
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want ParseErrors", err)
+	}
+	if len(errs) != 1 || errs[0].Line != 1 || errs[0].Column != 7 || errs[0].Severity != SeverityError {
+		t.Errorf("err = %v, want the TEMPO error at 1:7", errs)
+	}
+	if errs[0].File != name {
+		t.Errorf("File = %q, want %q", errs[0].File, name)
+	}
+}
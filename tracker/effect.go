@@ -0,0 +1,40 @@
+package tracker
+
+import "strconv"
+
+// Effect commands for the effect column (ProTracker-style "Cxy" notation)
+const (
+	EffectArpeggio    byte = '0' // 0xy: cycle note, note+x, note+y every tick
+	EffectPortaUp     byte = '1' // 1xx: slide pitch up by xx/16 semitone per tick
+	EffectPortaDown   byte = '2' // 2xx: slide pitch down by xx/16 semitone per tick
+	EffectTonePorta   byte = '3' // 3xx: slide towards the row's note at xx/16 semitone per tick
+	EffectVibrato     byte = '4' // 4xy: vibrato with speed x and depth y/8 semitone
+	EffectSetPan      byte = '8' // 8xx: set channel panning (00 left, 80 center, FF right)
+	EffectPulseWidth  byte = '9' // 9xx: set pulse width to xx/256 (80 square, 40 25%, 20 12.5%), 00 restores the instrument's
+	EffectVolumeSlide byte = 'A' // Axy: slide volume up by x/64 or down by y/64 per tick
+	EffectCutoff      byte = 'C' // Cxx: set filter cutoff from 20Hz (01) to 20kHz (FF), 00 restores the instrument's
+	EffectCutoffSlide byte = 'D' // Dxy: slide filter cutoff up by x/16 or down by y/16 octave per tick
+)
+
+// ParseEffect splits an effect column value like "4A8" into its command and
+// parameter byte. The command is returned upper-cased.
+func ParseEffect(s string) (command byte, param int, ok bool) {
+	if len(s) != 3 {
+		return 0, 0, false
+	}
+
+	command = s[0]
+	if command >= 'a' && command <= 'f' {
+		command -= 'a' - 'A'
+	}
+	if !(command >= '0' && command <= '9') && !(command >= 'A' && command <= 'F') {
+		return 0, 0, false
+	}
+
+	value, err := strconv.ParseUint(s[1:], 16, 8)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return command, int(value), true
+}
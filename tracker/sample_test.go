@@ -0,0 +1,123 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testWAV returns a mono 16-bit WAV file of a few frames
+func testWAV() []byte {
+	frames := []int16{0, 16384, 32767, 16384, 0, -16384, -32768, -16384}
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+2*len(frames)))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(2*len(frames)))
+	binary.Write(&b, binary.LittleEndian, frames)
+	return b.Bytes()
+}
+
+func TestSampleFileAccess(t *testing.T) {
+	fsys := fstest.MapFS{
+		"secret.wav":         {Data: testWAV()},
+		"music/song.vtm":     {Data: []byte("SAMPLE Kick kick.wav\n")},
+		"music/kick.wav":     {Data: testWAV()},
+		"music/drums/sn.wav": {Data: testWAV()},
+	}
+
+	tests := []struct {
+		name   string
+		file   string
+		loaded bool
+	}{
+		{"same directory", "kick.wav", true},
+		{"subdirectory", "drums/sn.wav", true},
+		{"parent directory", "../secret.wav", false},
+		{"cleaned parent directory", "drums/../../secret.wav", false},
+		{"absolute path", "/secret.wav", false},
+		{"backslashes", `..\secret.wav`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "SAMPLE Snd " + tt.file + "\n"
+			open := openSamples(fsys, "music")
+			module, diags, err := parseVTM(strings.NewReader(src), "music/song.vtm", open)
+			if err != nil {
+				t.Fatalf("parseVTM: %v", err)
+			}
+			if loaded := module.Instruments[0].Sample != nil; loaded != tt.loaded {
+				t.Errorf("sample loaded = %v, want %v (diagnostics: %v)", loaded, tt.loaded, diags)
+			}
+			if !tt.loaded && len(diags.Errors()) != 1 {
+				t.Errorf("diagnostics = %v, want one error", diags)
+			}
+		})
+	}
+}
+
+func TestParseVTMOpensNoFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kick.wav"), testWAV(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	src := "SAMPLE Kick kick.wav\n"
+	module, err := ParseVTM(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseVTM: %v", err)
+	}
+	if module.Instruments[0].Sample != nil {
+		t.Error("ParseVTM loaded a sample from the working directory")
+	}
+
+	module, err = ParseVTMFS(strings.NewReader(src), os.DirFS(dir))
+	if err != nil {
+		t.Fatalf("ParseVTMFS: %v", err)
+	}
+	if sample := module.Instruments[0].Sample; sample == nil || len(sample.Data) != 8 {
+		t.Errorf("ParseVTMFS sample = %v, want 8 frames", sample)
+	}
+}
+
+func TestLoadVTMSampleDirectory(t *testing.T) {
+	dir := t.TempDir()
+	songs := filepath.Join(dir, "songs")
+	if err := os.Mkdir(songs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		filepath.Join(dir, "outside.wav"): testWAV(),
+		filepath.Join(songs, "kick.wav"):  testWAV(),
+		filepath.Join(songs, "song.vtm"): []byte("SAMPLE Kick kick.wav\nSAMPLE Out ../outside.wav\n" +
+			"SAMPLE Abs " + filepath.Join(dir, "outside.wav") + "\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	module, diags, _ := LoadVTMStrict(filepath.Join(songs, "song.vtm"))
+	if module.Instruments[0].Sample == nil {
+		t.Errorf("kick.wav next to the module was not loaded: %v", diags)
+	}
+	for _, inst := range module.Instruments[1:] {
+		if inst.Sample != nil {
+			t.Errorf("%s outside the module directory was loaded", inst.SampleFile)
+		}
+	}
+	if len(diags.Errors()) != 2 {
+		t.Errorf("diagnostics = %v, want two errors", diags)
+	}
+}
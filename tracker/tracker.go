@@ -2,21 +2,33 @@ package tracker
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/cjbrigato/go-vtm/internal/wav"
 	"github.com/cjbrigato/go-vtm/synth"
 )
 
 // TrackerNote represents a note (or chord) in a pattern
 type TrackerNote struct {
 	Note       int     // MIDI note number (-1 for rest, -2 for note-off)
-	Instrument int     // Instrument number
-	Volume     float64 // 0.0 to 1.0
-	Effect     string  // Effect command
+	Instrument int     // Instrument number (1-based, 0 keeps the channel's current instrument)
+	Volume     float64 // 0.0 (silent) to 1.0, parsed notes without a volume column get 1.0
+	Effect     string  // Effect command (e.g. "4A8", empty if none)
 	Chord      []int   // Additional notes for harmony (nil if single note)
+
+	// Velocity per chord note from voice lines (nil plays every chord note at Volume)
+	ChordVolume []float64
 }
 
 // Pattern represents a pattern of notes across channels
@@ -35,6 +47,17 @@ type Instrument struct {
 	Decay    float64
 	Sustain  float64
 	Release  float64
+	Params   map[string]string // key=value parameters, e.g. "width" for PULSE waves
+
+	// Sample playback (SAMPLE lines), replacing the wave
+	SampleFile string        // WAV file as written, relative to the module file
+	Sample     *synth.Sample // nil if the file could not be loaded
+
+	// Breakpoint envelopes evaluated every tick (nil if not declared):
+	// volume (0.0 to 1.0), pitch (semitones) and panning (-1.0 to 1.0)
+	VolumeEnvelope *synth.BreakpointEnvelope
+	PitchEnvelope  *synth.BreakpointEnvelope
+	PanEnvelope    *synth.BreakpointEnvelope
 
 	// FM synthesis
 	IsFM        bool
@@ -44,6 +67,14 @@ type Instrument struct {
 	FMParams map[string]string
 }
 
+// Limits on the sizes a module may declare, so that a short file cannot make
+// the parser or the player allocate huge patterns and voice pools
+const (
+	MaxChannels = 64   // Channels of a pattern, CHANNELS and PAN channel numbers
+	MaxVoices   = 32   // Voices per channel, POLYPHONY and Vn voice numbers
+	MaxRows     = 1024 // Rows of a pattern
+)
+
 // TrackerModule represents a complete tracker module
 type TrackerModule struct {
 	Title       string
@@ -52,9 +83,13 @@ type TrackerModule struct {
 	Patterns    []Pattern
 	Sequence    []int // Pattern order
 	Instruments []Instrument
+	Panning     []float64 // Initial pan per channel (-1.0 left to 1.0 right, missing = center)
+	Channels    int       // Channel count for playback (0 = widest pattern)
+	Polyphony   int       // Voices per channel for playback (0 = widest chord)
 }
 
 // LoadVTM loads a VESAsterizer Tracker Module file
+// Problems in the file are skipped silently, use LoadVTMStrict to report them
 func LoadVTM(filename string) (*TrackerModule, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -62,6 +97,322 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 	}
 	defer file.Close()
 
+	module, _, err := parseVTM(file, filename, openRelative(filename))
+	return module, err
+}
+
+// ParseVTM reads a VESAsterizer Tracker Module from r
+// Like LoadVTM, problems in the module are skipped silently. No files are
+// opened, so SAMPLE instruments play silence; use ParseVTMFS to load them.
+func ParseVTM(r io.Reader) (*TrackerModule, error) {
+	module, _, err := parseVTM(r, "<input>", nil)
+	return module, err
+}
+
+// ParseVTMFS reads a VESAsterizer Tracker Module from r, loading SAMPLE
+// files from the root of fsys
+func ParseVTMFS(r io.Reader, fsys fs.FS) (*TrackerModule, error) {
+	module, _, err := parseVTM(r, "<input>", openSamples(fsys, "."))
+	return module, err
+}
+
+// LoadVTMFS loads a VESAsterizer Tracker Module from a file system,
+// such as an embed.FS holding the game's music
+func LoadVTMFS(fsys fs.FS, name string) (*TrackerModule, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	module, _, err := parseVTM(file, name, openSamples(fsys, path.Dir(name)))
+	return module, err
+}
+
+// LoadVTMStrict loads a VESAsterizer Tracker Module file and reports every
+// problem found in it. diags holds all errors and warnings in file order.
+// err is non-nil if the file could not be read or if any diagnostic is an
+// error, in which case it is a ParseErrors holding only the errors.
+// The module is returned even with errors, parsed as LoadVTM would.
+func LoadVTMStrict(filename string) (module *TrackerModule, diags ParseErrors, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	module, diags, err = parseVTM(file, filename, openRelative(filename))
+	if err == nil {
+		if errs := diags.Errors(); len(errs) > 0 {
+			err = errs
+		}
+	}
+	return module, diags, err
+}
+
+// openRelative opens SAMPLE files relative to the directory of a module file
+func openRelative(filename string) func(name string) (io.ReadCloser, error) {
+	return openSamples(os.DirFS(filepath.Dir(filename)), ".")
+}
+
+// openSamples opens SAMPLE files relative to a directory of a file system
+// Absolute paths and paths leading out of the directory are rejected, so a
+// module cannot read files it was not shipped with.
+func openSamples(fsys fs.FS, dir string) func(name string) (io.ReadCloser, error) {
+	return func(name string) (io.ReadCloser, error) {
+		if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+			return nil, fmt.Errorf("%s: path must be relative to the module and stay in its directory", name)
+		}
+		return fsys.Open(path.Join(dir, name))
+	}
+}
+
+// vtmParser collects diagnostics while a VTM file is parsed
+type vtmParser struct {
+	filename string
+	line     int
+	diags    ParseErrors
+	open     func(name string) (io.ReadCloser, error) // Opens SAMPLE files (nil if none can be)
+}
+
+// field is a whitespace-separated word of a line and its 1-based column
+type field struct {
+	text   string
+	column int
+}
+
+// splitFields splits a line like strings.Fields, keeping column positions
+func splitFields(line string) []field {
+	var fields []field
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		if i == len(line) || line[i] == ' ' || line[i] == '\t' {
+			if start >= 0 {
+				fields = append(fields, field{text: line[start:i], column: start + 1})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+func (p *vtmParser) report(severity Severity, column int, format string, args ...any) {
+	p.diags = append(p.diags, ParseError{
+		File:     p.filename,
+		Line:     p.line,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+		Severity: severity,
+	})
+}
+
+func (p *vtmParser) errorf(column int, format string, args ...any) {
+	p.report(SeverityError, column, format, args...)
+}
+
+func (p *vtmParser) warnf(column int, format string, args ...any) {
+	p.report(SeverityWarning, column, format, args...)
+}
+
+// atoi parses an integer field, reporting it if invalid
+func (p *vtmParser) atoi(f field, what string) int {
+	value, err := strconv.Atoi(strings.TrimSuffix(f.text, ":"))
+	if err != nil {
+		p.errorf(f.column, "invalid %s %q", what, f.text)
+	}
+	return value
+}
+
+// positive parses an integer field that must be greater than zero
+func (p *vtmParser) positive(f field, what string) int {
+	value, err := strconv.Atoi(f.text)
+	if err != nil {
+		p.errorf(f.column, "invalid %s %q", what, f.text)
+	} else if value <= 0 {
+		p.errorf(f.column, "%s must be positive", what)
+	}
+	return value
+}
+
+// atMost reports a count read from a field that is above limit, and returns
+// it clamped to the limit
+func (p *vtmParser) atMost(f field, value, limit int, what string) int {
+	if value > limit {
+		p.errorf(f.column, "%s %d is more than the maximum of %d", what, value, limit)
+		return limit
+	}
+	return value
+}
+
+// parseFloat parses a float field, reporting it if invalid
+func (p *vtmParser) parseFloat(f field, what string) float64 {
+	value, err := strconv.ParseFloat(f.text, 64)
+	if err != nil {
+		p.errorf(f.column, "invalid %s %q", what, f.text)
+	}
+	return value
+}
+
+// parseEnvelope parses the points, sustain and loop of an ENV line
+func (p *vtmParser) parseEnvelope(fields []field) *synth.BreakpointEnvelope {
+	env := synth.NewBreakpointEnvelope()
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch strings.ToUpper(f.text) {
+		case "SUSTAIN":
+			if i+1 >= len(fields) {
+				p.errorf(f.column, "SUSTAIN needs a tick")
+				continue
+			}
+			env.Sustain = p.atoi(fields[i+1], "sustain tick")
+			if env.Sustain < 0 {
+				p.errorf(fields[i+1].column, "sustain tick must not be negative")
+				env.Sustain = -1
+			}
+			i++
+			continue
+		case "LOOP":
+			if i+2 >= len(fields) {
+				p.errorf(f.column, "LOOP needs a start and an end tick")
+				i = len(fields)
+				continue
+			}
+			env.LoopStart = p.atoi(fields[i+1], "loop start")
+			env.LoopEnd = p.atoi(fields[i+2], "loop end")
+			if env.LoopEnd <= env.LoopStart || env.LoopStart < 0 {
+				p.errorf(fields[i+1].column, "loop start must be at least 0 and before the loop end")
+			}
+			i += 2
+			continue
+		}
+
+		tickText, valueText, ok := strings.Cut(f.text, ":")
+		if !ok {
+			p.errorf(f.column, "expected tick:value, got %q", f.text)
+			continue
+		}
+		tick, err := strconv.Atoi(tickText)
+		if err != nil || tick < 0 {
+			p.errorf(f.column, "invalid tick %q", tickText)
+			continue
+		}
+		value, err := strconv.ParseFloat(valueText, 64)
+		if err != nil {
+			p.errorf(f.column, "invalid value %q", valueText)
+			continue
+		}
+		if n := len(env.Points); n > 0 && tick <= env.Points[n-1].Tick {
+			p.errorf(f.column, "envelope ticks must increase")
+			continue
+		}
+		env.Points = append(env.Points, synth.Breakpoint{Tick: tick, Value: value})
+	}
+	if len(env.Points) == 0 {
+		p.errorf(0, "envelope has no points")
+	}
+	return env
+}
+
+// checkNote reports a note token that parseTrackerNote does not understand
+func (p *vtmParser) checkNote(f field) {
+	if msg := checkTrackerNote(f.text); msg != "" {
+		p.errorf(f.column, "%s", msg)
+	}
+}
+
+// checkFMParams reports FMINSTRUMENT parameters the synth cannot apply
+func (p *vtmParser) checkFMParams(inst Instrument, fields []field) {
+	// The sample rate does not matter for validation
+	fm, ok := synth.NewFMPreset(inst.FMPreset, 44100)
+	if !ok {
+		return
+	}
+	p.paramErrors(fm.ApplyParams(inst.FMParams), fields)
+}
+
+// loadSample reads the WAV file of a SAMPLE line, returning nil if it cannot
+func (p *vtmParser) loadSample(f field) *synth.Sample {
+	if p.open == nil {
+		p.errorf(f.column, "cannot open sample %s: no file system to load samples from", f.text)
+		return nil
+	}
+	file, err := p.open(f.text)
+	if err != nil {
+		p.errorf(f.column, "cannot open sample: %v", err)
+		return nil
+	}
+	defer file.Close()
+
+	decoded, err := wav.Decode(file)
+	if err != nil {
+		p.errorf(f.column, "cannot read sample %s: %v", f.text, err)
+		return nil
+	}
+	sample := synth.NewSample(decoded.Channels, float64(decoded.SampleRate))
+
+	// The smpl chunk gives the defaults, MIDI note 60 being C-4
+	if decoded.UnityNote >= 12 && decoded.UnityNote < 12+12*9 {
+		sample.BaseNote = decoded.UnityNote - 12
+	}
+	if len(decoded.Loops) > 0 {
+		loop := decoded.Loops[0]
+		sample.LoopStart, sample.LoopEnd = loop.Start, loop.End
+		if loop.Type == wav.LoopAlternating {
+			sample.Mode = synth.SamplePingPong
+		}
+	}
+	return sample
+}
+
+// checkSampleParams reports SAMPLE parameters the synth cannot apply
+func (p *vtmParser) checkSampleParams(inst Instrument, fields []field) {
+	if inst.Sample == nil {
+		return // Already reported, and loops cannot be checked without the sample
+	}
+	voice := synth.NewSampleVoice(inst.Sample, 44100)
+	p.paramErrors(voice.ApplyParams(inst.Params), fields)
+}
+
+// checkParams reports INSTRUMENT parameters the synth cannot apply
+func (p *vtmParser) checkParams(inst Instrument, fields []field) {
+	voice := synth.NewVoice(inst.WaveType, 44100)
+	p.paramErrors(voice.ApplyParams(inst.Params), fields)
+}
+
+// paramErrors reports each parameter error joined in err at the column of
+// the key=value field it came from
+func (p *vtmParser) paramErrors(err error, fields []field) {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return
+	}
+
+	for _, err := range joined.Unwrap() {
+		key := ""
+		var paramErr *synth.ParamError
+		var fmParamErr *synth.FMParamError
+		switch {
+		case errors.As(err, &paramErr):
+			key = paramErr.Key
+		case errors.As(err, &fmParamErr):
+			key = fmParamErr.Key
+		default:
+			continue
+		}
+		column := 0
+		for _, f := range fields {
+			if strings.HasPrefix(f.text, key+"=") {
+				column = f.column
+			}
+		}
+		p.errorf(column, "%v", err)
+	}
+}
+
+// parseVTM parses a module, recording every problem found as a diagnostic
+func parseVTM(r io.Reader, filename string, open func(name string) (io.ReadCloser, error)) (*TrackerModule, ParseErrors, error) {
 	module := &TrackerModule{
 		Tempo:       120,
 		TicksPerRow: 6,
@@ -70,11 +421,22 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 		Instruments: make([]Instrument, 0),
 	}
 
-	scanner := bufio.NewScanner(file)
+	p := &vtmParser{filename: filename, open: open}
+
+	// References that can only be checked once the whole file is read
+	type reference struct {
+		line, column, index int
+	}
+	var sequenceRefs, instrumentRefs, channelRefs, voiceRefs []reference
+	var channelsLine, polyphonyLine int
+
+	scanner := bufio.NewScanner(r)
 	var currentPattern *Pattern
+	var patternLine int
 	var currentChannel int
 
 	for scanner.Scan() {
+		p.line++
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
@@ -82,13 +444,23 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 			continue
 		}
 
-		parts := strings.Fields(line)
-		if len(parts) == 0 {
+		fields := splitFields(scanner.Text())
+		if len(fields) == 0 {
 			continue
 		}
+		parts := make([]string, len(fields))
+		for i, f := range fields {
+			parts[i] = f.text
+		}
 
 		command := strings.TrimSuffix(parts[0], ":")
 
+		// Voice lines V0:, V1:, ... all share one case
+		voiceNum, isVoice := voiceNumber(command)
+		if isVoice {
+			command = "V"
+		}
+
 		switch command {
 		case "TITLE":
 			if len(parts) > 1 {
@@ -97,26 +469,98 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 
 		case "TEMPO":
 			if len(parts) > 1 {
-				module.Tempo, _ = strconv.Atoi(parts[1])
+				module.Tempo = p.positive(fields[1], "tempo")
+			} else {
+				p.errorf(0, "TEMPO needs a value")
+			}
+
+		case "TICKS":
+			// TICKS 6 - number of effect ticks per row
+			if len(parts) > 1 {
+				module.TicksPerRow = p.positive(fields[1], "tick count")
+			} else {
+				p.errorf(0, "TICKS needs a value")
+			}
+
+		case "CHANNELS":
+			// CHANNELS 12 - number of channels the player creates
+			if len(parts) > 1 {
+				module.Channels = p.atMost(fields[1], p.positive(fields[1], "channel count"), MaxChannels, "channel count")
+				channelsLine = p.line
+			} else {
+				p.errorf(0, "CHANNELS needs a value")
+			}
+
+		case "POLYPHONY":
+			// POLYPHONY 6 - number of voices per channel
+			if len(parts) > 1 {
+				module.Polyphony = p.atMost(fields[1], p.positive(fields[1], "voice count"), MaxVoices, "voice count")
+				polyphonyLine = p.line
+			} else {
+				p.errorf(0, "POLYPHONY needs a value")
+			}
+
+		case "PAN":
+			// PAN 0 -0.5 - initial stereo position of a channel
+			if len(parts) > 2 {
+				channel := p.atoi(fields[1], "channel number")
+				pan := p.parseFloat(fields[2], "pan position")
+				if channel < 0 {
+					p.errorf(fields[1].column, "channel number must not be negative")
+					break
+				}
+				if channel >= MaxChannels {
+					p.errorf(fields[1].column, "channel %d out of range (at most %d channels)", channel, MaxChannels)
+					break
+				}
+				if pan < -1.0 || pan > 1.0 {
+					p.errorf(fields[2].column, "pan position must be between -1.0 and 1.0")
+					pan = math.Max(-1.0, math.Min(1.0, pan))
+				}
+				for len(module.Panning) <= channel {
+					module.Panning = append(module.Panning, 0.0)
+				}
+				module.Panning[channel] = pan
+			} else {
+				p.errorf(0, "PAN needs a channel number and a position")
 			}
 
 		case "INSTRUMENT":
+			// INSTRUMENT Name Wave Attack Decay Sustain Release [key=value ...]
 			if len(parts) >= 7 {
 				inst := Instrument{
 					Name:     parts[1],
 					WaveType: parseWaveType(parts[2]),
 					IsFM:     false,
+					Params:   make(map[string]string),
+				}
+				if !isWaveType(parts[2]) {
+					p.warnf(fields[2].column, "unknown wave type %q, using SQUARE", parts[2])
 				}
-				inst.Attack, _ = strconv.ParseFloat(parts[3], 64)
-				inst.Decay, _ = strconv.ParseFloat(parts[4], 64)
-				inst.Sustain, _ = strconv.ParseFloat(parts[5], 64)
-				inst.Release, _ = strconv.ParseFloat(parts[6], 64)
+				inst.Attack = p.parseFloat(fields[3], "attack")
+				inst.Decay = p.parseFloat(fields[4], "decay")
+				inst.Sustain = p.parseFloat(fields[5], "sustain")
+				inst.Release = p.parseFloat(fields[6], "release")
+				// Optional key=value parameters after the envelope, e.g. "width=0.25"
+				for i := 7; i < len(parts); i++ {
+					if kv := strings.Split(parts[i], "="); len(kv) == 2 {
+						inst.Params[kv[0]] = kv[1]
+					} else {
+						p.errorf(fields[i].column, "expected key=value, got %q", parts[i])
+					}
+				}
+				p.checkParams(inst, fields[7:])
 				module.Instruments = append(module.Instruments, inst)
+			} else {
+				p.errorf(0, "INSTRUMENT needs a name, a wave type and 4 ADSR values")
 			}
 
 		case "FMINSTRUMENT":
-			// FMINSTRUMENT Name Preset
-			// Where Preset can be: PIANO, EPIANO, or CUSTOM (future extension)
+			// FMINSTRUMENT Name Preset [key=value ...]
+			// Where Preset can be: PIANO, EPIANO, BASS, LEAD, BRASS, BELL, ARP, or CUSTOM
+			// key=value pairs override preset settings, e.g. "PIANO mod=2.2" or
+			// "CUSTOM alg=1 op1.ratio=2 op1.adsr=0.001,0.1,0.5,0.2 mod=3.0"
+			// or "CUSTOM alg=dx7:5 fb=6 op2.ratio=14" (see FMInstrument.ApplyParams)
 			if len(parts) >= 3 {
 				inst := Instrument{
 					Name:     parts[1],
@@ -124,24 +568,98 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 					FMPreset: strings.ToUpper(parts[2]),
 					FMParams: make(map[string]string),
 				}
+				if !synth.IsFMPreset(inst.FMPreset) {
+					p.warnf(fields[2].column, "unknown FM preset %q, using LEAD", parts[2])
+				}
 				// Parse any additional parameters after the preset name
 				for i := 3; i < len(parts); i++ {
 					param := parts[i]
 					if kv := strings.Split(param, "="); len(kv) == 2 {
 						inst.FMParams[kv[0]] = kv[1]
+					} else {
+						p.errorf(fields[i].column, "expected key=value, got %q", param)
+					}
+				}
+				p.checkFMParams(inst, fields[3:])
+				module.Instruments = append(module.Instruments, inst)
+			} else {
+				p.errorf(0, "FMINSTRUMENT needs a name and a preset")
+			}
+
+		case "SAMPLE":
+			// SAMPLE Name file.wav [key=value ...]
+			// The file is relative to the module, e.g. "SAMPLE Kick kick.wav base=C-4 loop=1200,4800"
+			if len(parts) >= 3 {
+				inst := Instrument{
+					Name:       parts[1],
+					SampleFile: parts[2],
+					Sample:     p.loadSample(fields[2]),
+					Params:     make(map[string]string),
+				}
+				for i := 3; i < len(parts); i++ {
+					if kv := strings.Split(parts[i], "="); len(kv) == 2 {
+						inst.Params[kv[0]] = kv[1]
+					} else {
+						p.errorf(fields[i].column, "expected key=value, got %q", parts[i])
 					}
 				}
+				p.checkSampleParams(inst, fields[3:])
 				module.Instruments = append(module.Instruments, inst)
+			} else {
+				p.errorf(0, "SAMPLE needs a name and a WAV file")
+			}
+
+		case "ENV":
+			// ENV Instrument VOL|PITCH|PAN tick:value ... [SUSTAIN tick] [LOOP start end]
+			if len(parts) < 4 {
+				p.errorf(0, "ENV needs an instrument, a type and at least one tick:value point")
+				break
+			}
+			var inst *Instrument
+			for i := range module.Instruments {
+				if module.Instruments[i].Name == parts[1] {
+					inst = &module.Instruments[i]
+					break
+				}
+			}
+			if inst == nil {
+				p.errorf(fields[1].column, "ENV refers to unknown instrument %q, define it first", parts[1])
+				break
+			}
+			env := p.parseEnvelope(fields[3:])
+			switch strings.ToUpper(parts[2]) {
+			case "VOL":
+				inst.VolumeEnvelope = env
+			case "PITCH":
+				inst.PitchEnvelope = env
+			case "PAN":
+				inst.PanEnvelope = env
+			default:
+				p.errorf(fields[2].column, "unknown envelope type %q, expected VOL, PITCH or PAN", parts[2])
 			}
 
 		case "PATTERN":
+			if currentPattern != nil {
+				p.errorf(0, "PATTERN started on line %d is missing ENDPATTERN", patternLine)
+			}
 			if len(parts) > 2 {
-				rows, _ := strconv.Atoi(parts[1])
-				channels, _ := strconv.Atoi(parts[2])
+				rows := p.atoi(fields[1], "row count")
+				channels := p.atoi(fields[2], "channel count")
+				if rows < 0 {
+					p.errorf(fields[1].column, "row count must not be negative")
+					rows = 0
+				}
+				if channels < 0 {
+					p.errorf(fields[2].column, "channel count must not be negative")
+					channels = 0
+				}
+				rows = p.atMost(fields[1], rows, MaxRows, "row count")
+				channels = p.atMost(fields[2], channels, MaxChannels, "channel count")
 				currentPattern = &Pattern{
 					Rows:     rows,
 					Channels: make([][]TrackerNote, channels),
 				}
+				patternLine = p.line
 				for i := range currentPattern.Channels {
 					currentPattern.Channels[i] = make([]TrackerNote, rows)
 					// Initialize with rests
@@ -149,71 +667,99 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 						currentPattern.Channels[i][j] = TrackerNote{Note: -1, Volume: 1.0}
 					}
 				}
+			} else {
+				p.errorf(0, "PATTERN needs a row count and a channel count")
 			}
 
 		case "CH":
-			// CH 0: C-4 01 F .. (original format)
+			// CH 0: C-4 02 E-4 ... (original format)
 			// CH 0: (multi-line voice format - just set channel)
+			if currentPattern == nil {
+				p.errorf(0, "CH outside of a PATTERN")
+			} else if len(parts) < 2 {
+				p.errorf(0, "CH needs a channel number")
+			}
 			if currentPattern != nil && len(parts) >= 2 {
 				// Remove colon from channel number
-				chanStr := strings.TrimSuffix(parts[1], ":")
-				currentChannel, _ = strconv.Atoi(chanStr)
-
-				// If there are notes on the same line (original format)
-				if len(parts) > 2 {
-					// Parse notes after the channel specification
-					for i := 2; i < len(parts); i++ {
-						row := i - 2
-						if row >= currentPattern.Rows {
-							break
-						}
-						note := parseTrackerNote(parts[i])
-						if currentChannel < len(currentPattern.Channels) {
-							currentPattern.Channels[currentChannel][row] = note
-						}
+				currentChannel = p.atoi(fields[1], "channel number")
+				if currentChannel < 0 || currentChannel >= len(currentPattern.Channels) {
+					p.errorf(fields[1].column, "channel %d out of range (pattern has %d channels)",
+						currentChannel, len(currentPattern.Channels))
+					// The notes of the line have nowhere to go
+					break
+				}
+				channelRefs = append(channelRefs, reference{p.line, fields[1].column, currentChannel})
+
+				// Parse the notes after the channel specification, if any
+				notes := joinInstrumentColumns(fields[2:])
+				for row, f := range notes {
+					if row >= currentPattern.Rows {
+						p.warnf(f.column, "%d rows given, pattern has %d", len(notes), currentPattern.Rows)
+						break
+					}
+					p.checkNote(f)
+					note := parseTrackerNote(f.text)
+					if note.Instrument > 0 {
+						instrumentRefs = append(instrumentRefs, reference{p.line, f.column, note.Instrument})
 					}
+					currentPattern.Channels[currentChannel][row] = note
 				}
 			}
 
-		case "V0", "V1", "V2", "V3":
+		case "V":
 			// Voice-specific line: V0: C-4 ... E-4 ===
 			// Parses notes for a specific voice within the current channel
+			if currentPattern == nil {
+				p.errorf(0, "%s outside of a PATTERN", parts[0])
+			}
+			if voiceNum >= MaxVoices {
+				p.errorf(fields[0].column, "voice %d out of range (at most %d voices)", voiceNum, MaxVoices)
+				break
+			}
 			if currentPattern != nil && currentChannel >= 0 && currentChannel < len(currentPattern.Channels) {
-				voiceNum := int(command[1] - '0') // Extract voice number from V0, V1, etc.
+				voiceRefs = append(voiceRefs, reference{p.line, fields[0].column, voiceNum})
 
 				// Parse notes for this voice
-				for i := 1; i < len(parts); i++ {
-					row := i - 1
+				notes := joinInstrumentColumns(fields[1:])
+				for row, f := range notes {
 					if row >= currentPattern.Rows {
+						p.warnf(f.column, "%d rows given, pattern has %d", len(notes), currentPattern.Rows)
 						break
 					}
 
-					noteStr := parts[i]
 					existingNote := currentPattern.Channels[currentChannel][row]
 
 					// Parse the note for this voice
-					parsedNote := parseTrackerNote(noteStr)
+					p.checkNote(f)
+					parsedNote := parseTrackerNote(f.text)
+
+					// The effect and instrument columns belong to the whole
+					// channel row, so any voice line may carry them
+					if parsedNote.Effect != "" {
+						existingNote.Effect = parsedNote.Effect
+					}
+					if parsedNote.Instrument > 0 {
+						existingNote.Instrument = parsedNote.Instrument
+						instrumentRefs = append(instrumentRefs, reference{p.line, f.column, parsedNote.Instrument})
+					}
 
 					if voiceNum == 0 {
 						// Voice 0 is the main note
 						// Accept: notes (>=0), note-off (-2), sustain (-3), rest (-1)
 						if parsedNote.Note >= -3 {
 							existingNote.Note = parsedNote.Note
-							if parsedNote.Volume > 0 {
-								existingNote.Volume = parsedNote.Volume
-							}
+							existingNote.Volume = parsedNote.Volume
 						}
 					} else {
-						// Voices 1-3 go in the Chord array
-						if existingNote.Chord == nil {
-							existingNote.Chord = make([]int, 3) // Need 3 for voices 1-3
-							for j := range existingNote.Chord {
-								existingNote.Chord[j] = -1 // Initialize to rest
-							}
+						// Voices 1 and up go in the Chord array, at least 3 of them
+						for len(existingNote.Chord) < max(voiceNum, 3) {
+							existingNote.Chord = append(existingNote.Chord, -1) // Initialize to rest
+							existingNote.ChordVolume = append(existingNote.ChordVolume, 1.0)
 						}
 						// Accept: notes (>=0), note-off (-2), sustain (-3), rest (-1)
 						if parsedNote.Note >= -3 && voiceNum-1 < len(existingNote.Chord) {
 							existingNote.Chord[voiceNum-1] = parsedNote.Note
+							existingNote.ChordVolume[voiceNum-1] = parsedNote.Volume
 						}
 					}
 
@@ -225,17 +771,65 @@ func LoadVTM(filename string) (*TrackerModule, error) {
 			if currentPattern != nil {
 				module.Patterns = append(module.Patterns, *currentPattern)
 				currentPattern = nil
+			} else {
+				p.errorf(0, "ENDPATTERN without PATTERN")
 			}
 
 		case "SEQUENCE":
 			for i := 1; i < len(parts); i++ {
-				patNum, _ := strconv.Atoi(parts[i])
+				patNum := p.atoi(fields[i], "pattern number")
+				if patNum < 0 {
+					p.errorf(fields[i].column, "pattern number must not be negative")
+					continue
+				}
+
+				sequenceRefs = append(sequenceRefs, reference{p.line, fields[i].column, patNum})
 				module.Sequence = append(module.Sequence, patNum)
 			}
+
+		default:
+			p.errorf(fields[0].column, "unknown command %q", parts[0])
+		}
+	}
+
+	if currentPattern != nil {
+		p.line = patternLine
+		p.errorf(0, "PATTERN is missing ENDPATTERN and was ignored")
+	}
+
+	// Check references now that every pattern and instrument is known
+	for _, ref := range sequenceRefs {
+		if ref.index < 0 || ref.index >= len(module.Patterns) {
+			p.line = ref.line
+			p.warnf(ref.column, "sequence refers to missing pattern %d", ref.index)
 		}
 	}
+	for _, ref := range channelRefs {
+		if module.Channels > 0 && ref.index >= module.Channels {
+			p.line = ref.line
+			p.warnf(ref.column, "channel %d is not played (CHANNELS %d on line %d)", ref.index, module.Channels, channelsLine)
+		}
+	}
+	for _, ref := range voiceRefs {
+		if module.Polyphony > 0 && ref.index >= module.Polyphony {
+			p.line = ref.line
+			p.warnf(ref.column, "voice %d is not played (POLYPHONY %d on line %d)", ref.index, module.Polyphony, polyphonyLine)
+		}
+	}
+	for _, ref := range instrumentRefs {
+		if ref.index > len(module.Instruments) {
+			p.line = ref.line
+			p.warnf(ref.column, "note refers to missing instrument %d", ref.index)
+		}
+	}
+	slices.SortStableFunc(p.diags, func(a, b ParseError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
 
-	return module, scanner.Err()
+	return module, p.diags, scanner.Err()
 }
 
 func parseWaveType(s string) synth.WaveType {
@@ -250,15 +844,148 @@ func parseWaveType(s string) synth.WaveType {
 		return synth.Sine
 	case "NOISE":
 		return synth.Noise
+	case "BLSQUARE":
+		return synth.SquareBL
+	case "BLSAW":
+		return synth.SawBL
+	case "BLTRIANGLE":
+		return synth.TriangleBL
+	case "PINKNOISE":
+		return synth.PinkNoise
+	case "BROWNNOISE":
+		return synth.BrownNoise
+	case "LFSRNOISE":
+		return synth.LFSRLong
+	case "LFSRSHORT":
+		return synth.LFSRShort
+	case "PULSE":
+		return synth.Pulse
+	case "BLPULSE":
+		return synth.PulseBL
 	default:
 		return synth.Square
 	}
 }
 
+// voiceNumber extracts n from a voice line command "Vn"
+func voiceNumber(command string) (int, bool) {
+	if len(command) < 2 || command[0] != 'V' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(command[1:])
+	if err != nil || n < 0 || command[1] == '+' || command[1] == '-' {
+		return 0, false
+	}
+	return n, true
+}
+
+// isWaveType returns true if parseWaveType knows the wave name
+func isWaveType(s string) bool {
+	return strings.EqualFold(s, waveTypeToString(parseWaveType(s)))
+}
+
+// checkTrackerNote describes what is wrong with a note token,
+// or returns "" if parseTrackerNote understands it
+func checkTrackerNote(s string) string {
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		if _, _, ok := ParseEffect(s[i+1:]); !ok {
+			return fmt.Sprintf("invalid effect %q", s[i+1:])
+		}
+		return checkTrackerNote(s[:i])
+	}
+
+	if i := strings.LastIndexAny(s, "iv"); i > 0 {
+		value, err := strconv.Atoi(s[i+1:])
+		switch {
+		case s[i] == 'i' && (err != nil || value < 0):
+			return fmt.Sprintf("invalid instrument %q", s[i+1:])
+		case s[i] == 'v' && (err != nil || value < 0 || value > 64):
+			return fmt.Sprintf("invalid volume %q (expected 00 to 64)", s[i+1:])
+		}
+		return checkTrackerNote(s[:i])
+	}
+
+	switch s {
+	case "---", "...", "..", "===", "OFF", "off":
+		return ""
+	}
+
+	if len(s) > 2 && s[0] == '[' && s[len(s)-1] == ']' {
+		for _, n := range strings.Split(s[1:len(s)-1], "+") {
+			if !isNote(n) {
+				return fmt.Sprintf("invalid note %q in chord %q", n, s)
+			}
+		}
+		return ""
+	}
+
+	if !isNote(s) {
+		return fmt.Sprintf("invalid note %q", s)
+	}
+	return ""
+}
+
+// joinInstrumentColumns merges instrument columns written as a separate
+// two-digit field after a note, tracker style, into the note: "C-4 02" reads
+// as "C-4i02" and "C-4:037 02" as "C-4i02:037". The column does not count as
+// a row, and notes given an instrument with "iNN" take no second one.
+func joinInstrumentColumns(fields []field) []field {
+	notes := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if n := len(notes); n > 0 && isInstrumentColumn(f.text) && !strings.ContainsRune(notes[n-1].text, 'i') {
+			prev := &notes[n-1]
+			if i := strings.IndexByte(prev.text, ':'); i >= 0 {
+				prev.text = prev.text[:i] + "i" + f.text + prev.text[i:]
+			} else {
+				prev.text += "i" + f.text
+			}
+			continue
+		}
+		notes = append(notes, f)
+	}
+	return notes
+}
+
+// isInstrumentColumn returns true for a separate instrument column like "02"
+func isInstrumentColumn(s string) bool {
+	return len(s) == 2 && s[0] >= '0' && s[0] <= '9' && s[1] >= '0' && s[1] <= '9'
+}
+
+// isNote returns true for a well-formed note name like "C-4" or "F#5"
+func isNote(s string) bool {
+	return len(s) == 3 && (s[1] == '-' || s[1] == '#') && synth.ParseNote(s) >= 0
+}
+
 func parseTrackerNote(s string) TrackerNote {
 	// Format: "C-4" or "---" for rest or "===" for note-off
 	// Format: "[C-4+E-4+G-4]" for chords (multiple notes)
 	// Format: "..." or ".." means SUSTAIN (keep previous note playing, no retrigger)
+	// Format: any of the above followed by ":xyz" adds an effect column, e.g. "C-4:037"
+	// Format: a note followed by "iNN" selects instrument NN (1-based), e.g. "C-4i02"
+	// (pattern lines also take it as a separate column, "C-4 02", see joinInstrumentColumns)
+	// Format: a note followed by "vNN" sets its volume to NN/64, e.g. "C-4v48" or "C-4i02v48"
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		note := parseTrackerNote(s[:i])
+		if _, _, ok := ParseEffect(s[i+1:]); ok {
+			note.Effect = strings.ToUpper(s[i+1:])
+		}
+		return note
+	}
+
+	if i := strings.LastIndexAny(s, "iv"); i > 0 {
+		note := parseTrackerNote(s[:i])
+		value, err := strconv.Atoi(s[i+1:])
+		if err != nil || value < 0 {
+			return note
+		}
+		if s[i] == 'i' {
+			note.Instrument = value
+		} else {
+			note.Volume = float64(min(value, 64)) / 64.0
+		}
+		return note
+	}
+
 	if s == "---" {
 		return TrackerNote{Note: -1, Instrument: 0, Volume: 1.0}
 	}
@@ -320,11 +1047,34 @@ func SaveVTM(filename string, module *TrackerModule) error {
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+
+	if err := WriteVTM(file, module); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteVTM writes a module in VTM format.
+// The output reloads into a module identical to the one written: note-offs,
+// sustains, chords, volumes, instruments and effects are all preserved.
+func WriteVTM(w io.Writer, module *TrackerModule) error {
+	file := bufio.NewWriter(w)
 
 	fmt.Fprintf(file, "# VESAsterizer Tracker Module\n")
 	fmt.Fprintf(file, "TITLE %s\n", module.Title)
-	fmt.Fprintf(file, "TEMPO %d\n\n", module.Tempo)
+	fmt.Fprintf(file, "TEMPO %d\n", module.Tempo)
+	fmt.Fprintf(file, "TICKS %d\n", module.TicksPerRow)
+	if module.Channels > 0 {
+		fmt.Fprintf(file, "CHANNELS %d\n", module.Channels)
+	}
+	if module.Polyphony > 0 {
+		fmt.Fprintf(file, "POLYPHONY %d\n", module.Polyphony)
+	}
+	for ch, pan := range module.Panning {
+		fmt.Fprintf(file, "PAN %d %s\n", ch, formatFloat(pan))
+	}
+	fmt.Fprintf(file, "\n")
 
 	// Write instruments
 	for _, inst := range module.Instruments {
@@ -332,37 +1082,83 @@ func SaveVTM(filename string, module *TrackerModule) error {
 			fmt.Fprintf(file, "FMINSTRUMENT %s %s",
 				inst.Name,
 				inst.FMPreset)
-			// Write any custom parameters
-			for k, v := range inst.FMParams {
-				fmt.Fprintf(file, " %s=%s", k, v)
+			// Write any custom parameters, sorted so output is stable
+			for _, k := range slices.Sorted(maps.Keys(inst.FMParams)) {
+				fmt.Fprintf(file, " %s=%s", k, inst.FMParams[k])
+			}
+			fmt.Fprintf(file, "\n")
+		} else if inst.SampleFile != "" {
+			fmt.Fprintf(file, "SAMPLE %s %s", inst.Name, inst.SampleFile)
+			for _, k := range slices.Sorted(maps.Keys(inst.Params)) {
+				fmt.Fprintf(file, " %s=%s", k, inst.Params[k])
 			}
 			fmt.Fprintf(file, "\n")
 		} else {
-			fmt.Fprintf(file, "INSTRUMENT %s %s %.3f %.3f %.3f %.3f\n",
+			fmt.Fprintf(file, "INSTRUMENT %s %s %s %s %s %s",
 				inst.Name,
 				waveTypeToString(inst.WaveType),
-				inst.Attack, inst.Decay, inst.Sustain, inst.Release)
+				formatFloat(inst.Attack), formatFloat(inst.Decay),
+				formatFloat(inst.Sustain), formatFloat(inst.Release))
+			for _, k := range slices.Sorted(maps.Keys(inst.Params)) {
+				fmt.Fprintf(file, " %s=%s", k, inst.Params[k])
+			}
+			fmt.Fprintf(file, "\n")
 		}
+		writeEnvelope(file, inst.Name, "VOL", inst.VolumeEnvelope)
+		writeEnvelope(file, inst.Name, "PITCH", inst.PitchEnvelope)
+		writeEnvelope(file, inst.Name, "PAN", inst.PanEnvelope)
 	}
 	fmt.Fprintf(file, "\n")
 
 	// Write patterns
-	for patIdx, pattern := range module.Patterns {
+	for _, pattern := range module.Patterns {
 		fmt.Fprintf(file, "PATTERN %d %d\n", pattern.Rows, len(pattern.Channels))
-		for ch := 0; ch < len(pattern.Channels); ch++ {
-			fmt.Fprintf(file, "CH %d:", ch)
-			for row := 0; row < pattern.Rows; row++ {
-				note := pattern.Channels[ch][row]
-				if note.Note < 0 {
-					fmt.Fprintf(file, " ---")
-				} else {
-					fmt.Fprintf(file, " %s", synth.FormatNote(note.Note))
+		for ch, notes := range pattern.Channels {
+			notes = notes[:min(len(notes), pattern.Rows)]
+
+			if !usesVoiceLines(notes) {
+				// Single-line format, chords written as [C-4+E-4+G-4]
+				fmt.Fprintf(file, "CH %d:", ch)
+				for _, note := range notes {
+					fmt.Fprintf(file, " %s", formatTrackerNote(note))
 				}
+				fmt.Fprintf(file, "\n")
+				continue
+			}
+
+			// Voice-line format: V0 holds the main note, V1.. the chord notes
+			voices, chordRows := 0, 0
+			for row, note := range notes {
+				if note.Chord != nil {
+					voices = max(voices, len(note.Chord))
+					chordRows = row + 1
+				}
+			}
+
+			fmt.Fprintf(file, "CH %d:\n", ch)
+			fmt.Fprintf(file, "V0:")
+			for _, note := range notes {
+				note.Chord = nil
+				fmt.Fprintf(file, " %s", formatTrackerNote(note))
 			}
 			fmt.Fprintf(file, "\n")
+
+			for v := 0; v < voices; v++ {
+				fmt.Fprintf(file, "V%d:", v+1)
+				for _, note := range notes[:chordRows] {
+					voice := TrackerNote{Note: -1, Volume: 1.0}
+					if v < len(note.Chord) {
+						voice.Note = note.Chord[v]
+					}
+					if v < len(note.ChordVolume) {
+						voice.Volume = note.ChordVolume[v]
+					}
+					fmt.Fprintf(file, " %s", formatTrackerNote(voice))
+				}
+				fmt.Fprintf(file, "\n")
+			}
 		}
 		fmt.Fprintf(file, "ENDPATTERN\n\n")
-		_ = patIdx
 	}
 
 	// Write sequence
@@ -372,7 +1168,74 @@ func SaveVTM(filename string, module *TrackerModule) error {
 	}
 	fmt.Fprintf(file, "\n")
 
-	return nil
+	return file.Flush()
+}
+
+// usesVoiceLines reports whether a channel was written with V0, V1.. lines,
+// which is the only format carrying per-voice note-offs, sustains and volumes
+func usesVoiceLines(notes []TrackerNote) bool {
+	for _, note := range notes {
+		if note.ChordVolume != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTrackerNote is the inverse of parseTrackerNote
+func formatTrackerNote(note TrackerNote) string {
+	var s string
+	switch {
+	case note.Chord != nil:
+		parts := make([]string, 0, len(note.Chord)+1)
+		parts = append(parts, synth.FormatNote(note.Note))
+		for _, n := range note.Chord {
+			parts = append(parts, synth.FormatNote(n))
+		}
+		s = "[" + strings.Join(parts, "+") + "]"
+	case note.Note >= 0:
+		s = synth.FormatNote(note.Note)
+	case note.Note == -2:
+		s = "==="
+	case note.Note == -3:
+		s = "..."
+	default:
+		s = "---"
+	}
+
+	if note.Instrument > 0 {
+		s += fmt.Sprintf("i%02d", note.Instrument)
+	}
+	if note.Volume != 1.0 {
+		s += fmt.Sprintf("v%02d", int(math.Round(note.Volume*64.0)))
+	}
+	if note.Effect != "" {
+		s += ":" + note.Effect
+	}
+	return s
+}
+
+// writeEnvelope writes an ENV line, if the envelope is set
+func writeEnvelope(w io.Writer, name, kind string, env *synth.BreakpointEnvelope) {
+	if env == nil {
+		return
+	}
+	fmt.Fprintf(w, "ENV %s %s", name, kind)
+	for _, point := range env.Points {
+		fmt.Fprintf(w, " %d:%s", point.Tick, formatFloat(point.Value))
+	}
+	if env.Sustain >= 0 {
+		fmt.Fprintf(w, " SUSTAIN %d", env.Sustain)
+	}
+	if env.LoopStart >= 0 || env.LoopEnd >= 0 {
+		fmt.Fprintf(w, " LOOP %d %d", env.LoopStart, env.LoopEnd)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// formatFloat writes the shortest representation that parses back exactly
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
 func waveTypeToString(wt synth.WaveType) string {
@@ -387,6 +1250,24 @@ func waveTypeToString(wt synth.WaveType) string {
 		return "SINE"
 	case synth.Noise:
 		return "NOISE"
+	case synth.SquareBL:
+		return "BLSQUARE"
+	case synth.SawBL:
+		return "BLSAW"
+	case synth.TriangleBL:
+		return "BLTRIANGLE"
+	case synth.PinkNoise:
+		return "PINKNOISE"
+	case synth.BrownNoise:
+		return "BROWNNOISE"
+	case synth.LFSRLong:
+		return "LFSRNOISE"
+	case synth.LFSRShort:
+		return "LFSRSHORT"
+	case synth.Pulse:
+		return "PULSE"
+	case synth.PulseBL:
+		return "BLPULSE"
 	default:
 		return "SQUARE"
 	}
@@ -0,0 +1,164 @@
+package tracker
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteVTMRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"single line", `TITLE Single line
+TEMPO 140
+TICKS 4
+INSTRUMENT Lead SQUARE 0.01 0.1 0.6 0.2
+PATTERN 4 1
+CH 0: C-4 --- === ...
+ENDPATTERN
+SEQUENCE 0
+`},
+		{"instruments volumes and effects", `TEMPO 120
+INSTRUMENT Bass SAW 0.01 0.2 0.5 0.1
+INSTRUMENT Pulse PULSE 0.01 0.1 0.6 0.2 width=0.25
+FMINSTRUMENT Keys PIANO mod=2.2
+PATTERN 4 2
+CH 0: C-3i02 D-3v32 E-3i03v00:037 F-3:A04
+CH 1: [C-4+E-4+G-4] [D-4+F-4]v48 --- ===
+ENDPATTERN
+SEQUENCE 0 0
+`},
+		{"voice lines", `TEMPO 100
+POLYPHONY 5
+FMINSTRUMENT Piano PIANO
+PATTERN 3 1
+CH 0:
+V0: C-4v64 ... ===
+V1: E-4v32 === ---
+V2: G-4 ... ...
+V4: B-4v00 --- ---
+ENDPATTERN
+SEQUENCE 0
+`},
+		{"header directives and envelopes", `TITLE Header
+TEMPO 90
+CHANNELS 3
+PAN 0 -0.5
+PAN 2 1
+INSTRUMENT Pad SINE 0.5 0.5 0.8 1
+ENV Pad VOL 0:0 4:1 SUSTAIN 1 12:0
+ENV Pad PITCH 0:0 2:0.5 4:0 LOOP 0 2
+PATTERN 2 3
+CH 0: C-4 ---
+CH 2: --- G-4
+ENDPATTERN
+SEQUENCE 0
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := ParseVTM(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("ParseVTM: %v", err)
+			}
+			assertRoundTrip(t, want)
+		})
+	}
+}
+
+func TestWriteVTMRoundTripMusic(t *testing.T) {
+	files, err := filepath.Glob("../music/*.vtm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skip("no modules in ../music")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			want, err := LoadVTM(file)
+			if err != nil {
+				t.Fatalf("LoadVTM: %v", err)
+			}
+			assertRoundTrip(t, want)
+		})
+	}
+}
+
+// assertRoundTrip writes a module and checks that it parses back unchanged
+func assertRoundTrip(t *testing.T, want *TrackerModule) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteVTM(&buf, want); err != nil {
+		t.Fatalf("WriteVTM: %v", err)
+	}
+	got, err := ParseVTM(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseVTM of written module: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("module changed after WriteVTM, written as:\n%s", buf.String())
+	}
+}
+
+func TestFormatTrackerNote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"C-4", "C-4"},
+		{"---", "---"},
+		{"..", "..."},
+		{"OFF", "==="},
+		{"C-4i02", "C-4i02"},
+		{"C-4v32", "C-4v32"},
+		{"C-4v64", "C-4"},
+		{"C-4v00", "C-4v00"},
+		{"C-4i01v16:4A8", "C-4i01v16:4A8"},
+		{"[C-4+E-4+G-4]", "[C-4+E-4+G-4]"},
+		{"---:a04", "---:A04"},
+	}
+
+	for _, tt := range tests {
+		if got := formatTrackerNote(parseTrackerNote(tt.in)); got != tt.want {
+			t.Errorf("formatTrackerNote(parseTrackerNote(%q)) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInstrumentColumn(t *testing.T) {
+	// A separate two-digit column after a note is its instrument, not a row
+	tests := []struct {
+		columns string
+		inline  string
+	}{
+		{"CH 0: C-4 02 E-4 --- 01", "CH 0: C-4i02 E-4 ---i01"},
+		{"CH 0: C-4v32 02 ... E-4:037 01", "CH 0: C-4i02v32 ... E-4i01:037"},
+		{"CH 0:\nV0: C-4 02 E-4 01 ===\nV1: [G-4+B-4] 01", "CH 0:\nV0: C-4i02 E-4i01 ===\nV1: [G-4+B-4]i01"},
+	}
+
+	parse := func(lines string) *TrackerModule {
+		t.Helper()
+		src := "INSTRUMENT Bass SAW 0.01 0.2 0.5 0.1\nINSTRUMENT Lead SINE 0.01 0.1 0.6 0.2\n" +
+			"PATTERN 3 1\n" + lines + "\nENDPATTERN\nSEQUENCE 0\n"
+		module, diags, err := parseVTM(strings.NewReader(src), "x.vtm", nil)
+		if err != nil || len(diags) > 0 {
+			t.Fatalf("parseVTM(%q): %v %v", lines, err, diags)
+		}
+		return module
+	}
+
+	for _, tt := range tests {
+		got, want := parse(tt.columns), parse(tt.inline)
+		if !reflect.DeepEqual(got.Patterns, want.Patterns) {
+			t.Errorf("%q parses as %+v, want %+v", tt.columns, got.Patterns, want.Patterns)
+		}
+	}
+}
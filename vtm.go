@@ -3,6 +3,7 @@ package vtm
 import (
 	"fmt"
 	"slices"
+	"time"
 
 	"github.com/cjbrigato/go-vtm/audio"
 	"github.com/cjbrigato/go-vtm/tracker"
@@ -73,11 +74,41 @@ func (p *VTMPlayer) AudioPlayback() *audio.AudioPlayback {
 	return p.audioPlayback
 }
 
+// Mixer returns the channel mixer, e.g. to mute stems while playing
+func (p *VTMPlayer) Mixer() *audio.Mixer {
+	return p.audioPlayback.GetMixer()
+}
+
+// Compressor returns the master bus compressor, which is off by default
+func (p *VTMPlayer) Compressor() *audio.Compressor {
+	return p.audioPlayback.GetCompressor()
+}
+
+// Limiter returns the master bus limiter, e.g. to change its ceiling
+func (p *VTMPlayer) Limiter() *audio.Limiter {
+	return p.audioPlayback.GetLimiter()
+}
+
+// GainReduction returns how many dB the master bus limiter and compressor
+// are currently reducing the output by
+func (p *VTMPlayer) GainReduction() float64 {
+	return p.audioPlayback.GetGainReduction()
+}
+
 func NewVTMPlayer(filename string, sampleRate int) (*VTMPlayer, error) {
 	module, err := tracker.LoadVTM(filename)
 	if err != nil {
 		return nil, err
 	}
+	return NewVTMPlayerFromModule(module, sampleRate)
+}
+
+// NewVTMPlayerFromModule creates a player for an already loaded module,
+// e.g. one from tracker.ParseVTM or tracker.LoadVTMFS
+func NewVTMPlayerFromModule(module *tracker.TrackerModule, sampleRate int) (*VTMPlayer, error) {
+	if module == nil {
+		return nil, fmt.Errorf("nil module")
+	}
 	if !slices.Contains(compatibleSampleRates, sampleRate) {
 		return nil, fmt.Errorf("unsupported sample rate: %d (supported: %v)", sampleRate, compatibleSampleRates)
 	}
@@ -103,3 +134,29 @@ func (p *VTMPlayer) IsDone() bool {
 func (p *VTMPlayer) IsPlaying() bool {
 	return p.audioPlayback.IsPlaying()
 }
+
+// Position returns the order in the sequence, the row and the effect tick
+// that are playing
+// It reports the position being rendered, which is ahead of the audible
+// output by the audio device buffer, usually some tens of milliseconds.
+func (p *VTMPlayer) Position() (order, row, tick int) {
+	return p.audioPlayback.Position()
+}
+
+// Elapsed returns the playing time from the start of the sequence to the
+// current position
+// Like Position it runs ahead of the audible output by the device buffer.
+func (p *VTMPlayer) Elapsed() time.Duration {
+	return p.audioPlayback.Elapsed()
+}
+
+// Seek jumps to a row of an order in the sequence, even while playing
+func (p *VTMPlayer) Seek(order, row int) error {
+	return p.audioPlayback.Seek(order, row)
+}
+
+// SeekTime jumps to the row playing at a time from the start, even while
+// playing
+func (p *VTMPlayer) SeekTime(t time.Duration) error {
+	return p.audioPlayback.SeekTime(t)
+}